@@ -0,0 +1,128 @@
+package jdecode
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/toukii/jsnm"
+)
+
+// vars 捕获的变量, 模板中以@vars:name引用
+const vars = "vars"
+
+// ttlRe 持久化变量的过期时间: persist refresh := @data,refresh_token ttl 720h
+var ttlRe = regexp.MustCompile(`\s+ttl\s+(\S+)$`)
+
+// Capture 按捕获块从响应中提取变量, 保存到ctx中, 后续的模板以@vars:token引用; 捕获块每行一个变量:
+//
+//	token := @data,access_token
+//	uid := @data,user,id|upper
+//	persist refresh := @data,refresh_token ttl 720h
+//	# 注释
+//
+// 表达式中不带文档名的路径取自resp, 也可以引用ctx中的其他文档和已捕获的变量;
+// persist 的变量同时保存到ctx使用的Store中, 以后的运行中以@store:name引用
+func (d *Decoder) Capture(ctx *Context, block string, resp []byte) error {
+	doc := jsnm.BytesFmt(resp)
+	scanner := bufio.NewScanner(strings.NewReader(block))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ":=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("capture line %d: %s, want name := @path", n, line)
+		}
+		name, expr := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		persist := strings.HasPrefix(name, "persist ")
+		var ttl time.Duration
+		if persist {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "persist "))
+			if m := ttlRe.FindStringSubmatch(expr); m != nil {
+				var err error
+				if ttl, err = parseDuration(m[1]); err != nil {
+					return fmt.Errorf("capture line %d: %s, err:%+v", n, line, err)
+				}
+				expr = strings.TrimSpace(expr[:len(expr)-len(m[0])])
+			}
+		}
+		v, err := d.capture(ctx.forkDoc(resp, doc), expr)
+		if err != nil {
+			return fmt.Errorf("capture line %d: %s, err:%+v", n, line, err)
+		}
+		if err = ctx.SetVar(name, v); err != nil {
+			return err
+		}
+		if persist {
+			if err = ctx.persist(name, v, ttl); err != nil {
+				return fmt.Errorf("capture line %d: %s, err:%+v", n, line, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func Capture(ctx *Context, block string, resp []byte) error {
+	return std.Capture(ctx, block, resp)
+}
+
+// capture 求值 @path 或 @path|fn...
+func (d *Decoder) capture(ctx *Context, expr string) (interface{}, error) {
+	if !strings.HasPrefix(expr, "@") {
+		return nil, fmt.Errorf("%s should start with @", expr)
+	}
+	it := expr[1:]
+	var v interface{}
+	if p, ok := parsePipeline(it); ok {
+		var err error
+		if v, err = p.eval(d, ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		v = d.get(ctx, TrimPath(strings.Split(it, ",")).prefixPaths...).RawData().Raw()
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%s not found", expr)
+	}
+	return v, nil
+}
+
+func (c *Context) persist(name string, v interface{}, ttl time.Duration) error {
+	c.mu.RLock()
+	s := c.store
+	c.mu.RUnlock()
+	if s == nil {
+		return fmt.Errorf("persist %s: no store, see Context.UseStore", name)
+	}
+	return s.Set(name, v, ttl)
+}
+
+// SetVar 设置变量name
+func (c *Context) SetVar(name string, v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vs := make(map[string]interface{}, len(c.vars)+1)
+	for k, it := range c.vars {
+		vs[k] = it
+	}
+	vs[name] = v
+	bs, err := jsonen(vs)
+	if err != nil {
+		return fmt.Errorf("var %s: %+v", name, err)
+	}
+	c.vars = vs
+	c.docs[vars] = jsnm.BytesFmt(bs)
+	return nil
+}
+
+// Var 返回变量name
+func (c *Context) Var(name string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.vars[name]
+	return v, ok
+}
@@ -0,0 +1,66 @@
+package jdecode
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	t.Run("Capture", func(t *testing.T) {
+		ctx := NewContext(nil)
+		ctx.Set("login", []byte(`{"tenant":"t1"}`))
+		block := `
+			# login response
+			token := @data,access_token
+			uid := @data,user,id|upper
+			key := @vars:uid|concat('-', @login:tenant)
+			n := @data,roles|len
+		`
+		err := Capture(ctx, block, []byte(`{"data":{"access_token":"tk","user":{"id":"u1"},"roles":["a","b"]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"token": "tk", "uid": "U1", "key": "U1-t1", "n": 2}
+		for k, v := range want {
+			if got, ok := ctx.Var(k); !ok || !reflect.DeepEqual(got, v) {
+				t.Errorf("var %s ==> %+v, but: %+v", k, v, got)
+			}
+		}
+
+		raw := `{"token":"@vars:token","key":"@vars:key","n":"@vars:n"}`
+		des, _ := DecodeContext(raw, ctx)
+		if w := []string{`{"token":"tk","key":"U1-t1","n":2}`}; !reflect.DeepEqual(des, w) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, w, des)
+		}
+	})
+
+	t.Run("SetVar concurrent", func(t *testing.T) {
+		ctx := NewContext(nil)
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx.SetVar(fmt.Sprintf("v%d", i), i)
+			}(i)
+		}
+		wg.Wait()
+		for i := 0; i < 50; i++ {
+			raw := fmt.Sprintf(`{"v":"@vars:v%d"}`, i)
+			des, _ := DecodeContext(raw, ctx)
+			if w := []string{fmt.Sprintf(`{"v":%d}`, i)}; !reflect.DeepEqual(des, w) {
+				t.Errorf("decode: %s, want: %s, got: %s", raw, w, des)
+			}
+		}
+	})
+
+	t.Run("Capture err", func(t *testing.T) {
+		for _, block := range []string{"token = @token", "token := @nothing", "token := token"} {
+			if err := Capture(NewContext(nil), block, []byte(`{"token":"tk"}`)); err == nil {
+				t.Errorf("capture: %s, want err", block)
+			}
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package jdecode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// celPrefix 以cel:开头的条件按CEL求值:
+//
+//	{"coupon": {"$if": "cel:resp.cart.total > 100 && 'vip' in resp.user.tags", "$then": "SAVE10"}}
+//	{"sku": "@items,$range?where=cel:item.price > 10 && item.stock > 0"}
+//
+// resp为默认文档, item为$range的元素, vars为Capture捕获的变量
+const celPrefix = "cel:"
+
+var (
+	celOnce sync.Once
+	celEnv  *cel.Env
+	celErr  error
+
+	// celPrgs 编译过的CEL程序, 以表达式为key
+	celPrgs sync.Map
+)
+
+func newCelEnv() (*cel.Env, error) {
+	celOnce.Do(func() {
+		celEnv, celErr = cel.NewEnv(
+			cel.Variable("resp", cel.DynType),
+			cel.Variable("item", cel.DynType),
+			cel.Variable(vars, cel.MapType(cel.StringType, cel.DynType)),
+			cel.CrossTypeNumericComparisons(true),
+		)
+	})
+	return celEnv, celErr
+}
+
+// compileCel 编译并检查CEL表达式, 结果须为bool
+func compileCel(expr string) (cel.Program, error) {
+	if prg, ok := celPrgs.Load(expr); ok {
+		return prg.(cel.Program), nil
+	}
+	env, err := newCelEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("cel %s: %+v", expr, iss.Err())
+	}
+	if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("cel %s: result is %s, want bool", expr, t)
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("cel %s: %+v", expr, err)
+	}
+	celPrgs.Store(expr, prg)
+	return prg, nil
+}
+
+// evalCel 以ctx的默认文档为resp, item为$range的元素求值CEL条件
+func (d *Decoder) evalCel(ctx *Context, expr string, item interface{}) bool {
+	prg, err := compileCel(expr)
+	if err != nil {
+		log.Errorf("%s, err:%+v", expr, err)
+		return false
+	}
+	vs := make(map[string]interface{})
+	ctx.mu.RLock()
+	for k, v := range ctx.vars {
+		vs[k] = v
+	}
+	ctx.mu.RUnlock()
+	out, _, err := prg.Eval(map[string]interface{}{
+		"resp": d.get(ctx).RawData().Raw(),
+		"item": item,
+		vars:   vs,
+	})
+	if err != nil {
+		log.Errorf("%s, err:%+v", expr, err)
+		return false
+	}
+	ok, isBool := out.Value().(bool)
+	if !isBool {
+		log.Errorf("%s: result %+v is not bool", expr, out.Value())
+	}
+	return ok
+}
+
+// isCel 是否为CEL条件, 返回去掉前缀的表达式
+func isCel(cond string) (string, bool) {
+	cond = strings.TrimSpace(cond)
+	if !strings.HasPrefix(cond, celPrefix) {
+		return cond, false
+	}
+	return strings.TrimSpace(cond[len(celPrefix):]), true
+}
@@ -0,0 +1,70 @@
+package jdecode
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeCel(t *testing.T) {
+	ctx := NewContext([]byte(`{"cart":{"total":120.5,"tags":["vip"]},"items":[{"sku":"a","price":5,"stock":1},{"sku":"b","price":20,"stock":0},{"sku":"c","price":30,"stock":3}]}`))
+	if err := ctx.SetVar("min", 10); err != nil {
+		t.Fatal(err)
+	}
+	tcases := []testcase{
+		{
+			raw: `{"coupon":{"$if":"cel:resp.cart.total > 100 && 'vip' in resp.cart.tags","$then":"SAVE10"},"gift":{"$if":"cel:size(resp.items) > 5","$then":true}}`,
+			des: []string{`{"coupon":"SAVE10"}`},
+		},
+		{
+			raw: `{"sku":"@items,$range?where=cel:item.price > vars.min && item.stock > 0,sku"}`,
+			des: []string{`{"sku":"c"}`},
+		},
+		{
+			raw: `{"x":{"$if":"cel:resp.nothing.total > 1","$then":1,"$else":2}}`,
+			des: []string{`{"x":2}`},
+		},
+	}
+	for _, tc := range tcases {
+		tpl, err := Compile(tc.raw)
+		if err != nil {
+			t.Errorf("compile: %s, err: %+v", tc.raw, err)
+			continue
+		}
+		des, _ := tpl.Decode(ctx)
+		if !reflect.DeepEqual(des, tc.des) {
+			t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+		}
+	}
+}
+
+func TestTemplateDecoder(t *testing.T) {
+	d := NewDecoder(1)
+	d.SetClock(func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) })
+	tpl := d.MustCompile(`{"v":"@$now|format_time('date')"}`)
+	want := []string{`{"v":"2020-01-01"}`}
+	if des, _ := tpl.Decode(NewContext(nil)); !reflect.DeepEqual(des, want) {
+		t.Errorf("decode: %s, want: %s, got: %s", tpl.Raw(), want, des)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tcases := []string{
+		`{"a":`,
+		`{"a":{"$if":"cel:resp.a +","$then":1}}`,
+		`{"a":{"$if":"cel:1 + 2","$then":1}}`,
+		`{"a":{"$if":"cel:user.vip","$then":1}}`,
+		`{"a":{"$if":"total >","$then":1}}`,
+		`{"a":["@{page +}"]}`,
+		`{"a":"@items,$range?where=cel:size(item) + 'x' > 1"}`,
+		`{"a":"@items|nofunc"}`,
+	}
+	for _, raw := range tcases {
+		if _, err := Compile(raw); err == nil {
+			t.Errorf("compile: %s, want err", raw)
+		}
+	}
+	if _, err := Compile(`{"a":{"$if":"@cart,ok && total > 1","$then":"@{page + 1}"},"b":"@items,$range?where=price > 1","c":"@items|len"}`); err != nil {
+		t.Errorf("compile: %+v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package jdecode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var (
+	ifKey   = "$if"
+	thenKey = "$then"
+	elseKey = "$else"
+)
+
+// decodeIf 按条件保留或删除模板中的对象成员和数组元素:
+//
+//	{"coupon": {"$if": "@cart,eligible", "$then": "@cart,coupon"}}
+//	{"tier": {"$if": "@user,vip && !@user,banned", "$then": "gold", "$else": "normal"}}
+//	{"items": [{"$if": "@cart,gift", "sku": "gift", "qty": 1}]}
+//
+// 条件为真时取$then的值, 没有$then时取除$if, $else外的其他成员; 条件为假时取$else的值,
+// 没有$else时删除所在的成员或元素; 成员的顺序保持不变
+func (d *Decoder) decodeIf(ctx *Context, raw string) string {
+	if !strings.Contains(raw, quote(ifKey)) {
+		return raw
+	}
+	out, ok, err := d.rewriteIf(ctx, json.RawMessage(raw))
+	if err != nil {
+		log.Errorf("%s, err:%+v", raw, err)
+		return raw
+	}
+	if !ok {
+		return "null"
+	}
+	return string(out)
+}
+
+// rewriteIf 递归求值raw中的条件, ok为false时raw被删除
+func (d *Decoder) rewriteIf(ctx *Context, raw json.RawMessage) (json.RawMessage, bool, error) {
+	if !bytes.Contains(raw, []byte(quote(ifKey))) {
+		return raw, true, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	buf := &bytes.Buffer{}
+	switch tok {
+	case json.Delim('{'):
+		keys, vals, err := members(dec)
+		if err != nil {
+			return nil, false, err
+		}
+		for i, k := range keys {
+			if k == ifKey {
+				return d.branch(ctx, keys, vals, i)
+			}
+		}
+		buf.WriteByte('{')
+		n := 0
+		for i, k := range keys {
+			v, ok, err := d.rewriteIf(ctx, vals[i])
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s:%s", quote(k), v)
+			n++
+		}
+		buf.WriteByte('}')
+	case json.Delim('['):
+		buf.WriteByte('[')
+		n := 0
+		for dec.More() {
+			var it json.RawMessage
+			if err = dec.Decode(&it); err != nil {
+				return nil, false, err
+			}
+			v, ok, err := d.rewriteIf(ctx, it)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(v)
+			n++
+		}
+		buf.WriteByte(']')
+	default:
+		return raw, true, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// members 按顺序读取对象的成员
+func members(dec *json.Decoder) ([]string, []json.RawMessage, error) {
+	var keys []string
+	var vals []json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var v json.RawMessage
+		if err = dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, tok.(string))
+		vals = append(vals, v)
+	}
+	return keys, vals, nil
+}
+
+// branch 求值$if对象的条件, 返回选中的分支
+func (d *Decoder) branch(ctx *Context, keys []string, vals []json.RawMessage, ifIdx int) (json.RawMessage, bool, error) {
+	var then, els json.RawMessage
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range keys {
+		switch k {
+		case ifKey:
+		case thenKey:
+			then = vals[i]
+		case elseKey:
+			els = vals[i]
+		default:
+			if buf.Len() > 1 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s:%s", quote(k), vals[i])
+		}
+	}
+	buf.WriteByte('}')
+	if then == nil {
+		then = buf.Bytes()
+	}
+
+	var cond interface{}
+	if err := json.Unmarshal(vals[ifIdx], &cond); err != nil {
+		return nil, false, err
+	}
+	ok := truthy(cond)
+	if s, isStr := cond.(string); isStr {
+		if expr, isCel := isCel(s); isCel {
+			ok = d.evalCel(ctx, expr, nil)
+		} else {
+			ok = d.evalCond(ctx, s)
+		}
+	}
+	if ok {
+		return d.rewriteIf(ctx, then)
+	}
+	if els == nil {
+		return nil, false, nil
+	}
+	return d.rewriteIf(ctx, els)
+}
+
+// evalCond 求值条件: @path, !@path, 表达式, 以及用&&, ||组合的条件, &&优先; 不存在的路径为假:
+// @cart,eligible && !@user,banned, @{total > 100}, total > 100 || user.vip
+func (d *Decoder) evalCond(ctx *Context, cond string) bool {
+	for _, or := range splitOp(cond, "||") {
+		ok := true
+		for _, and := range splitOp(or, "&&") {
+			if !d.evalTerm(ctx, strings.TrimSpace(and)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Decoder) evalTerm(ctx *Context, term string) bool {
+	if strings.HasPrefix(term, "!") {
+		return !d.evalTerm(ctx, strings.TrimSpace(term[1:]))
+	}
+	if !strings.HasPrefix(term, "@") {
+		v, err := d.evalExpr(ctx, term)
+		if err != nil {
+			log.Errorf("%s, err:%+v", term, err)
+			return false
+		}
+		return truthy(v)
+	}
+	v, err := d.capture(ctx, term)
+	if err != nil {
+		log.Debugf("%s, err:%+v", term, err)
+		return false
+	}
+	return truthy(v)
+}
+
+// truthy false, null, 0, 空字符串, 空数组和空对象为假
+func truthy(v interface{}) bool {
+	switch vv := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return vv
+	case string:
+		return vv != ""
+	case []interface{}:
+		return len(vv) > 0
+	case map[string]interface{}:
+		return len(vv) > 0
+	}
+	f, err := toFloat(v)
+	return err != nil || f != 0
+}
+
+// splitOp 按 op 拆分条件, 忽略引号, 括号和表达式内的 op
+func splitOp(s, op string) []string {
+	ret := make([]string, 0, 2)
+	depth, start := 0, 0
+	var quot byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quot != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quot {
+				quot = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quot = s[i]
+		case s[i] == '(' || s[i] == '{':
+			depth++
+		case s[i] == ')' || s[i] == '}':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], op):
+			ret = append(ret, s[start:i])
+			start = i + len(op)
+			i += len(op) - 1
+		}
+	}
+	return append(ret, s[start:])
+}
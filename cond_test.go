@@ -0,0 +1,42 @@
+package jdecode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeIf(t *testing.T) {
+	prebs := []byte(`{"cart":{"eligible":true,"coupon":"SAVE10","gift":false,"items":[]},"user":{"vip":1,"banned":false,"name":"rob"}}`)
+	tcases := []testcase{
+		{
+			raw: `{"id":1,"coupon":{"$if":"@cart,eligible","$then":"@cart,coupon"},"name":"@user,name"}`,
+			des: []string{`{"id":1,"coupon":"SAVE10","name":"rob"}`},
+		},
+		{
+			raw: `{"id":1,"gift":{"$if":"@cart,gift","$then":"wrap"},"z":2}`,
+			des: []string{`{"id":1,"z":2}`},
+		},
+		{
+			raw: `{"tier":{"$if":"@user,vip && !@user,banned","$then":"gold","$else":"normal"}}`,
+			des: []string{`{"tier":"gold"}`},
+		},
+		{
+			raw: `{"tier":{"$if":"@cart,items || @user,missing","$then":"gold","$else":{"level":"@user,vip"}}}`,
+			des: []string{`{"tier":{"level":1}}`},
+		},
+		{
+			raw: `{"items":[1,{"$if":"@cart,eligible","sku":"gift","qty":1},{"$if":false,"$then":3},4]}`,
+			des: []string{`{"items":[1,{"sku":"gift","qty":1},4]}`},
+		},
+		{
+			raw: `{"n":{"$if":"@cart,items|len","$then":1,"$else":{"$if":"@user,name","$then":2}}}`,
+			des: []string{`{"n":2}`},
+		},
+	}
+	for _, tc := range tcases {
+		des, _ := Decode(tc.raw, prebs)
+		if !reflect.DeepEqual(des, tc.des) {
+			t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package jdecode
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/toukii/jsnm"
+)
+
+// colon 分隔文档名和路径: @login:token, @create_order:id,0
+var colon = rune(`:`[0])
+
+// Context 链式调用中的多个命名文档, 模板中可以同时引用: @login:token, @create_order:id,0;
+// 不带文档名的路径引用默认文档, 未设置env时@env:KEY同@$env,KEY
+type Context struct {
+	mu    sync.RWMutex
+	prebs []byte
+	docs  map[string]*jsnm.Jsnm
+	vars  map[string]interface{} // Capture捕获的变量
+	store *Store                 // @store:name 引用的持久化变量
+}
+
+// NewContext prebs为默认文档
+func NewContext(prebs []byte) *Context {
+	return &Context{
+		prebs: prebs,
+		docs:  map[string]*jsnm.Jsnm{"": jsnm.BytesFmt(prebs)},
+	}
+}
+
+// Set 设置名为name的json文档: ctx.Set("login", resp)
+func (c *Context) Set(name string, bs []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name == "" {
+		c.prebs = bs
+	}
+	c.docs[name] = jsnm.BytesFmt(bs)
+}
+
+// SetValue 设置名为name的文档为v的json
+func (c *Context) SetValue(name string, v interface{}) error {
+	bs, err := jsonen(v)
+	if err != nil {
+		return err
+	}
+	c.Set(name, bs)
+	return nil
+}
+
+// UseStore 使用持久化的变量, 模板中以@store:name引用, 捕获块中以persist保存
+func (c *Context) UseStore(s *Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = s
+}
+
+// Doc 返回名为name的文档
+func (c *Context) Doc(name string) (*jsnm.Jsnm, bool) {
+	c.mu.RLock()
+	doc, ok := c.docs[name]
+	s := c.store
+	c.mu.RUnlock()
+	// 读文件时不持有c.mu
+	if name == store && s != nil {
+		items, err := s.All()
+		if err != nil {
+			log.Errorf("@store: %+v", err)
+			return nil, false
+		}
+		bs, err := jsonen(items)
+		if err != nil {
+			log.Errorf("@store: %+v", err)
+			return nil, false
+		}
+		return jsnm.BytesFmt(bs), true
+	}
+	return doc, ok
+}
+
+// defaultDoc 返回默认文档
+func (c *Context) defaultDoc() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.prebs
+}
+
+// hasDoc 是否有名为name的文档, 不读取@store
+func (c *Context) hasDoc(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.docs[name]
+	return ok || name == "env" || (name == store && c.store != nil)
+}
+
+// trimDoc 路径中的文档名不是ctx中的文档时, :不属于路径: @host:8080 ==> host
+func (c *Context) trimDoc(it string) string {
+	seg := strings.SplitN(it, ",", 2)[0]
+	idx := strings.IndexRune(seg, colon)
+	if idx <= 0 || strings.HasPrefix(seg, "$") || c.hasDoc(seg[:idx]) {
+		return it
+	}
+	return seg[:idx]
+}
+
+// splitDoc 拆分路径中的文档名: [login:user name] ==> login [user name]
+func splitDoc(paths []string) (string, []string) {
+	if len(paths) <= 0 || !strings.ContainsRune(paths[0], colon) || strings.HasPrefix(paths[0], "$") {
+		return "", paths
+	}
+	kv := strings.SplitN(paths[0], ":", 2)
+	if kv[1] == "" && len(paths) == 1 {
+		return kv[0], nil
+	}
+	ret := make([]string, 0, len(paths))
+	return kv[0], append(append(ret, kv[1]), paths[1:]...)
+}
+
+// get 按路径取值, 以$env开头的路径取环境变量, 以name:开头的路径取ctx中名为name的文档
+func (d *Decoder) get(ctx *Context, paths ...string) *jsnm.Jsnm {
+	if len(paths) > 0 && paths[0] == env {
+		return d.env(paths[1:]...)
+	}
+	name, paths := splitDoc(paths)
+	doc, ok := ctx.Doc(name)
+	if !ok {
+		if name != "env" {
+			return jsnm.BytesFmt([]byte("null"))
+		}
+		return d.env(paths...)
+	}
+	return doc.ArrGet(paths...)
+}
+
+// fork 复制ctx, 以prebs为默认文档
+func (c *Context) fork(prebs []byte) *Context {
+	return c.forkDoc(prebs, jsnm.BytesFmt(prebs))
+}
+
+// forkDoc 同fork, doc为已解析的prebs
+func (c *Context) forkDoc(prebs []byte, doc *jsnm.Jsnm) *Context {
+	ret := &Context{
+		prebs: prebs,
+		docs:  map[string]*jsnm.Jsnm{"": doc},
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, doc := range c.docs {
+		if name != "" {
+			ret.docs[name] = doc
+		}
+	}
+	ret.store = c.store
+	return ret
+}
@@ -0,0 +1,72 @@
+package jdecode
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeContext(t *testing.T) {
+	os.Setenv("JDECODE_TENANT_ID", "t-env")
+	defer os.Unsetenv("JDECODE_TENANT_ID")
+
+	ctx := NewContext([]byte(`{"msg":"prev"}`))
+	ctx.Set("login", []byte(`{"token":"tk","user":{"name":"rob"}}`))
+	ctx.Set("create_order", []byte(`{"id":[1001,1002]}`))
+	if err := ctx.SetValue("data", iv{"items": []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("DecodeContext", func(t *testing.T) {
+		tcases := []testcase{
+			{
+				raw: `{"msg":"@msg","token":"@login:token","order":"@create_order:id,0"}`,
+				des: []string{`{"msg":"prev","token":"tk","order":1001}`},
+			},
+			{
+				raw: `{"auth":"@login:token|concat('-', @login:user.name)","n":"@create_order:id|len","t":"@env:JDECODE_TENANT_ID"}`,
+				des: []string{`{"auth":"tk-rob","n":2,"t":"t-env"}`},
+			},
+			{
+				raw: `{"item":"@data:items,$range","token":"@login:token"}`,
+				des: []string{`{"item":"a","token":"tk"}`, `{"item":"b","token":"tk"}`},
+			},
+			{
+				raw: `{"token":"@nodoc:token"}`,
+				des: []string{`{"token":"@nodoc:token"}`},
+			},
+			{
+				raw: `{"url":"@msg:8080/api","doc":"@login:user,name"}`,
+				des: []string{`{"url":"prev:8080/api","doc":"rob"}`},
+			},
+		}
+		for _, tc := range tcases {
+			des, _ := DecodeContext(tc.raw, ctx)
+			if !reflect.DeepEqual(des, tc.des) {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+			}
+		}
+	})
+}
+
+func TestSplitDoc(t *testing.T) {
+	t.Run("splitDoc", func(t *testing.T) {
+		ts := []struct {
+			paths []string
+			name  string
+			want  []string
+		}{
+			{[]string{"login:token"}, "login", []string{"token"}},
+			{[]string{"create_order:id", "0"}, "create_order", []string{"id", "0"}},
+			{[]string{"login:"}, "login", nil},
+			{[]string{"msg"}, "", []string{"msg"}},
+			{[]string{"$env", "HOST"}, "", []string{"$env", "HOST"}},
+		}
+		for _, it := range ts {
+			name, paths := splitDoc(it.paths)
+			if name != it.name || !reflect.DeepEqual(paths, it.want) {
+				t.Errorf("%+v ==> %s %+v, but: %s %+v", it.paths, it.name, it.want, name, paths)
+			}
+		}
+	})
+}
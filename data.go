@@ -0,0 +1,144 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// csvColumn csv的列, 表头中以:指定类型: id:int, price:float, active:bool, tags:json
+type csvColumn struct {
+	name, typ string
+}
+
+// DecodeDataCSVFile 读取带表头的csv文件, 每行转为一个对象: {"$file":[{"email":"a@b.c","age":18},...]}
+// 表头 age:int 指定列的类型, 支持 string(默认), int, float, bool, json; 类型列的空值为null
+func DecodeDataCSVFile(filename string) string {
+	return readSource(filename, func(f *os.File) (Source, error) {
+		return newCSVSource(f)
+	})
+}
+
+// DecodeDataSourceFile 以OpenSource读取数据文件的全部记录: {"$file":[...]}, 用于压缩的文件和多个文件
+func DecodeDataSourceFile(name string) string {
+	src, err := OpenSource(name)
+	if err != nil {
+		log.Errorf("%s, err:%+v", name, err)
+		return ""
+	}
+	return readAll(name, src)
+}
+
+// readSource 读取数据文件的全部记录: {"$file":[...]}, 出错时返回""
+func readSource(filename string, open func(f *os.File) (Source, error)) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Errorf("%s, err:%+v", filename, err)
+		return ""
+	}
+	src, err := open(f)
+	if err != nil {
+		log.Errorf("%s, err:%+v", filename, err)
+		return ""
+	}
+	return readAll(filename, src)
+}
+
+// readAll 读取src的全部记录并关闭src
+func readAll(filename string, src Source) string {
+	defer src.Close()
+	ret, err := collect(src)
+	if err != nil {
+		log.Errorf("%s, err:%+v", filename, err)
+		return ""
+	}
+	return fmt.Sprintf(`{"$file":%s}`, ret)
+}
+
+// csvColumns 解析表头中的列名和类型, 列名不能重复
+func csvColumns(header []string) ([]csvColumn, error) {
+	cols := make([]csvColumn, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, it := range header {
+		if i == 0 {
+			it = strings.TrimPrefix(it, "\ufeff")
+		}
+		col := csvColumn{name: strings.TrimSpace(it), typ: "string"}
+		if idx := strings.LastIndex(col.name, ":"); idx > 0 {
+			col.name, col.typ = col.name[:idx], strings.ToLower(col.name[idx+1:])
+		}
+		switch col.typ {
+		case "string", "int", "float", "bool", "json":
+		default:
+			return nil, fmt.Errorf("column %s: unsupported type %s", col.name, col.typ)
+		}
+		if seen[col.name] {
+			return nil, fmt.Errorf("column %s: duplicate name", col.name)
+		}
+		seen[col.name] = true
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// csvValue 按列的类型转为json
+func csvValue(col csvColumn, cell string) (string, error) {
+	if col.typ == "string" {
+		return quote(cell), nil
+	}
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return "null", nil
+	}
+	switch col.typ {
+	case "int":
+		i, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case "float":
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return "", err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%s is not a finite number", cell)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case "bool":
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	}
+	if !json.Valid([]byte(cell)) {
+		return "", fmt.Errorf("invalid json %s", cell)
+	}
+	return cell, nil
+}
+
+// DecodeDataLineFile 读取文本文件, 每行为一个字符串: {"$file":["a","b"]}; 以"开头的行为json字符串
+func DecodeDataLineFile(filename string) string {
+	return readSource(filename, func(f *os.File) (Source, error) {
+		return newLineSource(f), nil
+	})
+}
+
+// DecodeDataNDJSONFile 读取每行一个json的文件(.ndjson, .jsonl): {"$file":[{...},{...}]}, 忽略空行
+func DecodeDataNDJSONFile(filename string) string {
+	return readSource(filename, func(f *os.File) (Source, error) {
+		return newNDJSONSource(f), nil
+	})
+}
+
+// DecodeDataJSONFile 读取json文件, 数组的每个元素为一条记录, 其他的值为一条记录
+func DecodeDataJSONFile(filename string) string {
+	return readSource(filename, func(f *os.File) (Source, error) {
+		return newJSONSource(f)
+	})
+}
@@ -0,0 +1,283 @@
+package jdecode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// cellRe 单元格: A1, 只有列时为整列: F
+var cellRe = regexp.MustCompile(`^([A-Za-z]+)([0-9]*)$`)
+
+const (
+	// maxExcelCols excel的最大列数, 最后一列为XFD
+	maxExcelCols = 16384
+	// maxExcelRows excel的最大行数
+	maxExcelRows = 1048576
+)
+
+// excelRange 选择的区域, 下标从0开始, 包含两端; toRow为-1时到最后一行
+type excelRange struct {
+	fromCol, fromRow, toCol, toRow int
+}
+
+// DecodeDataExcelFile 读取excel文件, filename后可以用#选择工作表和区域:
+//
+//	users.xlsx                   第一个工作表
+//	users.xlsx#Sheet2            工作表Sheet2
+//	users.xlsx#Sheet2!A1:F200    工作表Sheet2的A1:F200
+//
+// 区域的第一行为表头, 以下每行转为一个对象; 数字, 布尔保持类型, 日期转为RFC3339, 空行忽略;
+// $sheets 中为每个工作表的全部数据: {"$file":[...],"$sheets":{"Sheet1":[...],"Sheet2":[...]}}, 出错的工作表不在其中
+func DecodeDataExcelFile(filename string) string {
+	filename, sel := splitSheet(filename)
+	log.Infof("DecodeDataExcelFile %s ...", filename)
+	excel, err := xlsx.OpenFile(filename)
+	if err != nil {
+		log.Errorf("%s, err:%+v", filename, err)
+		return ""
+	}
+	ret, err := decodeExcel(excel, sel)
+	if err != nil {
+		log.Errorf("%s#%s, err:%+v", filename, sel, err)
+		return ""
+	}
+	return ret
+}
+
+// splitSheet 拆分文件名和选择的区域: users.xlsx#Sheet2!A1:F200 ==> users.xlsx, Sheet2!A1:F200
+func splitSheet(filename string) (string, string) {
+	idx := strings.LastIndex(filename, "#")
+	if idx < 0 {
+		return filename, ""
+	}
+	return filename[:idx], filename[idx+1:]
+}
+
+func decodeExcel(excel *xlsx.File, sel string) (string, error) {
+	name, area := splitArea(sel)
+	rng, err := parseRange(area)
+	if err != nil {
+		return "", err
+	}
+	sh, err := findSheet(excel, name)
+	if err != nil {
+		return "", err
+	}
+	file, err := sheetRecords(sh, rng, excel.Date1904)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `{"$file":%s,"$sheets":{`, file)
+	n := 0
+	for _, it := range excel.Sheets {
+		records, err := sheetRecords(it, excelRange{toCol: -1, toRow: -1}, excel.Date1904)
+		if err != nil {
+			// 其他工作表的错误不影响选择的数据
+			log.Errorf("$sheets, err:%+v", err)
+			continue
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s:%s", quote(it.Name), records)
+		n++
+	}
+	buf.WriteString("}}")
+	return buf.String(), nil
+}
+
+// splitArea 拆分工作表和区域: Sheet2!A1:F200 ==> Sheet2, A1:F200
+func splitArea(sel string) (string, string) {
+	if idx := strings.LastIndex(sel, "!"); idx >= 0 {
+		return sel[:idx], sel[idx+1:]
+	}
+	return sel, ""
+}
+
+// findSheet 名为name的工作表, name为空时为第一个工作表
+func findSheet(excel *xlsx.File, name string) (*xlsx.Sheet, error) {
+	if len(excel.Sheets) <= 0 {
+		return nil, fmt.Errorf("no sheet")
+	}
+	if name == "" {
+		return excel.Sheets[0], nil
+	}
+	sh, ok := excel.Sheet[name]
+	if !ok {
+		return nil, fmt.Errorf("sheet %s not found", name)
+	}
+	return sh, nil
+}
+
+// parseRange 解析区域 A1:F200, A:F; 为空时为整个工作表
+func parseRange(area string) (excelRange, error) {
+	rng := excelRange{toCol: -1, toRow: -1}
+	if area == "" {
+		return rng, nil
+	}
+	parts := strings.Split(area, ":")
+	if len(parts) != 2 {
+		return rng, fmt.Errorf("range %s, want A1:F200", area)
+	}
+	var err error
+	if rng.fromCol, rng.fromRow, err = parseCell(parts[0]); err != nil {
+		return rng, err
+	}
+	if rng.toCol, rng.toRow, err = parseCell(parts[1]); err != nil {
+		return rng, err
+	}
+	if rng.fromRow < 0 {
+		rng.fromRow = 0
+	}
+	if rng.toCol < rng.fromCol || (rng.toRow >= 0 && rng.toRow < rng.fromRow) {
+		return rng, fmt.Errorf("range %s is empty", area)
+	}
+	return rng, nil
+}
+
+// parseCell 解析单元格 B3 ==> 1, 2; 没有行号时行为-1
+func parseCell(cell string) (int, int, error) {
+	m := cellRe.FindStringSubmatch(cell)
+	if m == nil {
+		return 0, 0, fmt.Errorf("bad cell %s", cell)
+	}
+	col := 0
+	for _, r := range strings.ToUpper(m[1]) {
+		if col = col*26 + int(r-'A'+1); col > maxExcelCols {
+			return 0, 0, fmt.Errorf("bad cell %s, column after XFD", cell)
+		}
+	}
+	row := -1
+	if m[2] != "" {
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n <= 0 || n > maxExcelRows {
+			return 0, 0, fmt.Errorf("bad cell %s", cell)
+		}
+		row = n - 1
+	}
+	return col - 1, row, nil
+}
+
+// sheetRecords 工作表区域中的全部记录, 参见sheetSource
+func sheetRecords(sh *xlsx.Sheet, rng excelRange, date1904 bool) (string, error) {
+	src, err := newSheetSource(sh, rng, date1904)
+	if err != nil {
+		return "", err
+	}
+	return collect(src)
+}
+
+// sheetSource 以区域的第一行为表头, 以下每行逐条转为对象, 成员按列的顺序; 表头为空的列忽略, 列名不能重复, 空行忽略
+type sheetSource struct {
+	sh       *xlsx.Sheet
+	rng      excelRange
+	date1904 bool
+	header   []string
+	rows     []*xlsx.Row
+}
+
+func newSheetSource(sh *xlsx.Sheet, rng excelRange, date1904 bool) (*sheetSource, error) {
+	src := &sheetSource{sh: sh, rng: rng, date1904: date1904}
+	rows := sh.Rows
+	if rng.toRow >= 0 && rng.toRow+1 < len(rows) {
+		rows = rows[:rng.toRow+1]
+	}
+	if rng.fromRow >= len(rows) {
+		return src, nil
+	}
+	rows = rows[rng.fromRow:]
+	seen := make(map[string]bool, 8)
+	for _, c := range src.cells(rows[0]) {
+		name := strings.TrimSpace(c.String())
+		if name != "" && seen[name] {
+			return nil, fmt.Errorf("sheet %s, column %s: duplicate name", sh.Name, name)
+		}
+		seen[name] = true
+		src.header = append(src.header, name)
+	}
+	src.rows = rows[1:]
+	return src, nil
+}
+
+// cells 行中区域内的单元格
+func (s *sheetSource) cells(r *xlsx.Row) []*xlsx.Cell {
+	if r == nil || s.rng.fromCol >= len(r.Cells) {
+		return nil
+	}
+	cs := r.Cells[s.rng.fromCol:]
+	if s.rng.toCol >= 0 && s.rng.toCol-s.rng.fromCol+1 < len(cs) {
+		cs = cs[:s.rng.toCol-s.rng.fromCol+1]
+	}
+	return cs
+}
+
+func (s *sheetSource) Next() (json.RawMessage, error) {
+	for len(s.rows) > 0 {
+		cs := s.cells(s.rows[0])
+		s.rows = s.rows[1:]
+		buf := &bytes.Buffer{}
+		buf.WriteByte('{')
+		empty, n := true, 0
+		for i, name := range s.header {
+			if name == "" {
+				continue
+			}
+			v := "null"
+			if i < len(cs) && cs[i].Value != "" {
+				var err error
+				if v, err = cellValue(cs[i], s.date1904); err != nil {
+					return nil, fmt.Errorf("sheet %s, column %s: %+v", s.sh.Name, name, err)
+				}
+				empty = false
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s:%s", quote(name), v)
+			n++
+		}
+		if empty {
+			continue
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+	return nil, io.EOF
+}
+
+func (s *sheetSource) Close() error {
+	s.rows = nil
+	return nil
+}
+
+// cellValue 单元格的json: 日期为RFC3339, 数字, 布尔保持类型, 其余为字符串
+func cellValue(c *xlsx.Cell, date1904 bool) (string, error) {
+	if c.IsTime() {
+		t, err := c.GetTime(date1904)
+		if err != nil {
+			return "", err
+		}
+		return quote(t.Format(time.RFC3339)), nil
+	}
+	switch c.Type() {
+	case xlsx.CellTypeNumeric:
+		f, err := c.Float()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case xlsx.CellTypeBool:
+		return strconv.FormatBool(c.Bool()), nil
+	}
+	return quote(c.String()), nil
+}
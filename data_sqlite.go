@@ -0,0 +1,160 @@
+package jdecode
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePrefix sqlite数据源: @sqlite:fixtures.db?query=SELECT id,name FROM users WHERE active=1
+const sqlitePrefix = "sqlite:"
+
+// DecodeDataSQLite 执行sqlite数据库中的查询, 每行转为一个对象: {"$file":[{"id":1,"name":"a"},...]}
+// 整数, 浮点数保持类型, 文本和blob为字符串, 时间为RFC3339, NULL为null
+func DecodeDataSQLite(name string) string {
+	log.Infof("DecodeDataSQLite %s ...", name)
+	src, err := sqliteSource(name)
+	if err != nil {
+		log.Errorf("%s, err:%+v", name, err)
+		return ""
+	}
+	return readAll(name, src)
+}
+
+// splitQuery 拆分数据库文件和查询: sqlite:fixtures.db?query=SELECT ... ==> fixtures.db, SELECT ...
+// query 须为最后一个参数, 原样作为SQL, 不做url解码
+func splitQuery(name string) (string, string, error) {
+	name = strings.TrimPrefix(name, sqlitePrefix)
+	idx := strings.Index(name, "?query=")
+	if idx < 0 {
+		return "", "", fmt.Errorf("%s: no query, want sqlite:file.db?query=SELECT ...", name)
+	}
+	file, query := name[:idx], strings.TrimSpace(name[idx+len("?query="):])
+	if file == "" || query == "" {
+		return "", "", fmt.Errorf("%s: empty file or query", name)
+	}
+	return file, query, nil
+}
+
+// sqlSource 查询结果的每行为一条记录, 逐行读取
+type sqlSource struct {
+	db   *sql.DB
+	rows *sql.Rows
+	cols []string
+}
+
+// sqliteDSN 以只读方式打开file: file:fixtures.db?mode=ro, 文件名中的 ? # % 转义
+func sqliteDSN(file string) string {
+	return "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(file) + "?mode=ro"
+}
+
+func sqliteSource(name string) (Source, error) {
+	file, query, err := splitQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	// 文件不存在时sqlite会创建空的数据库
+	if _, err = os.Stat(file); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(file))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	if err == nil {
+		err = uniqueCols(cols)
+	}
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, err
+	}
+	return &sqlSource{db: db, rows: rows, cols: cols}, nil
+}
+
+// uniqueCols 查询结果的列名不能重复, 如 SELECT u.id, o.id 须以AS重命名
+func uniqueCols(cols []string) error {
+	seen := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		if seen[col] {
+			return fmt.Errorf("column %s: duplicate name, rename it with AS", col)
+		}
+		seen[col] = true
+	}
+	return nil
+}
+
+func (s *sqlSource) Next() (json.RawMessage, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	vals := make([]interface{}, len(s.cols))
+	ptrs := make([]interface{}, len(s.cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := s.rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, col := range s.cols {
+		v, err := sqlValue(vals[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %+v", col, err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s:%s", quote(col), v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (s *sqlSource) Close() error {
+	s.rows.Close()
+	return s.db.Close()
+}
+
+// sqlValue 列的值转为json
+func sqlValue(v interface{}) (string, error) {
+	switch it := v.(type) {
+	case nil:
+		return "null", nil
+	case int64:
+		return strconv.FormatInt(it, 10), nil
+	case float64:
+		if math.IsNaN(it) || math.IsInf(it, 0) {
+			return "", fmt.Errorf("%v is not a finite number", it)
+		}
+		return strconv.FormatFloat(it, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(it), nil
+	case []byte:
+		return quote(string(it)), nil
+	case string:
+		return quote(it), nil
+	case time.Time:
+		return quote(it.Format(time.RFC3339)), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", v)
+}
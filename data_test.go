@@ -0,0 +1,409 @@
+package jdecode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tealeg/xlsx"
+)
+
+func TestDecodeDataFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return "@" + file
+	}
+
+	t.Run("DecodeDataFile csv", func(t *testing.T) {
+		tcases := []struct {
+			file, want string
+		}{
+			{
+				file: write("users.csv", "\ufeffemail,name,age:int,score:float,vip:bool,tags:json\n"+
+					"a@x.com,\"Smith, \"\"Bob\"\"\",18,9.5,true,\"[\"\"a\"\"]\"\n"+
+					"b@x.com,Li,,,false,\n"),
+				want: `{"$file":[{"email":"a@x.com","name":"Smith, \"Bob\"","age":18,"score":9.5,"vip":true,"tags":["a"]},` +
+					`{"email":"b@x.com","name":"Li","age":null,"score":null,"vip":false,"tags":null}]}`,
+			},
+			{
+				file: write("empty.csv", ""),
+				want: `{"$file":[]}`,
+			},
+			{
+				file: write("badtype.csv", "age:long\n1\n"),
+				want: "",
+			},
+			{
+				file: write("badint.csv", "age:int\nx\n"),
+				want: "",
+			},
+			{
+				file: write("fields.csv", "a,b\n1\n"),
+				want: "",
+			},
+			{
+				file: write("nan.csv", "id,score:float\na,1\nb,NaN\n"),
+				want: "",
+			},
+			{
+				file: write("inf.csv", "score:float\n-Inf\n"),
+				want: "",
+			},
+			{
+				file: write("dup.csv", "id,name,id:int\n1,a,2\n"),
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			if got := DecodeDataFile(tc.file); got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.file, tc.want, got)
+			}
+		}
+
+		src, _ := newCSVSource(ioutil.NopCloser(strings.NewReader("id,score:float\na,1\nb,NaN\n")))
+		src.Next()
+		if _, err := src.Next(); err == nil || !strings.Contains(err.Error(), "line 3, column score") {
+			t.Errorf("NaN score, want err at line 3, column score, got: %+v", err)
+		}
+
+		raw := `{"email":"@$file,$range,email"}`
+		des, _ := Decode(raw, []byte(DecodeDataFile(tcases[0].file)))
+		if want := []string{`{"email":"a@x.com"}`, `{"email":"b@x.com"}`}; !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+	})
+
+	t.Run("DecodeDataFile json", func(t *testing.T) {
+		tcases := []struct {
+			file, want string
+		}{
+			{
+				file: write("orders.ndjson", "{\"id\": 1, \"items\": [{\"sku\": \"a\"}]}\n\n{\"id\": 2, \"items\": []}\n"),
+				want: `{"$file":[{"id":1,"items":[{"sku":"a"}]},{"id":2,"items":[]}]}`,
+			},
+			{
+				file: write("orders.jsonl", "{\"id\": 1}\n{\"id\": \n"),
+				want: "",
+			},
+			{
+				file: write("orders.json", "[\n  {\"id\": 1, \"b\": true},\n  {\"id\": 2}\n]\n"),
+				want: `{"$file":[{"id":1,"b":true},{"id":2}]}`,
+			},
+			{
+				file: write("order.json", "{\"id\": 1}"),
+				want: `{"$file":[{"id":1}]}`,
+			},
+			{
+				file: write("none.json", ""),
+				want: `{"$file":[]}`,
+			},
+			{
+				file: write("blank.json", " \n"),
+				want: `{"$file":[]}`,
+			},
+			{
+				file: write("concat.json", "{\"a\":1}{\"a\":2}"),
+				want: "",
+			},
+			{
+				file: write("trailing.json", "[1,2] xx"),
+				want: "",
+			},
+			{
+				file: write("open.json", "[1,2"),
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			if got := DecodeDataFile(tc.file); got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.file, tc.want, got)
+			}
+		}
+
+		raw := `{"order":"@$file,$range"}`
+		des, _ := Decode(raw, []byte(DecodeDataFile(tcases[0].file)))
+		if want := []string{`{"order":{"id":1,"items":[{"sku":"a"}]}}`, `{"order":{"id":2,"items":[]}}`}; !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+	})
+
+	t.Run("DecodeDataFile xlsx", func(t *testing.T) {
+		excel := xlsx.NewFile()
+		users, _ := excel.AddSheet("users")
+		orders, _ := excel.AddSheet("orders")
+		addRow := func(sh *xlsx.Sheet, cells ...interface{}) {
+			row := sh.AddRow()
+			for _, it := range cells {
+				c := row.AddCell()
+				switch v := it.(type) {
+				case string:
+					c.SetString(v)
+				case float64:
+					c.SetFloat(v)
+				case bool:
+					c.SetBool(v)
+				case time.Time:
+					c.SetDateTime(v)
+				}
+			}
+		}
+		addRow(users, "email", "age", "vip", "joined", "", "note")
+		addRow(users, "a@x.com", 18.0, true, time.Date(2024, 3, 10, 8, 30, 0, 0, time.UTC), "skip", "")
+		addRow(users, "", "", "", "", "", "")
+		addRow(users, "b@x.com", 20.5, false)
+		addRow(orders, "no", "id", "sku")
+		addRow(orders, 1.0, "o1", "a")
+		addRow(orders, 2.0, "o2", "b")
+		addRow(orders, 3.0, "o3", "c")
+
+		sheets := `"$sheets":{"users":[{"email":"a@x.com","age":18,"vip":true,"joined":"2024-03-10T08:30:00Z","note":null},` +
+			`{"email":"b@x.com","age":20.5,"vip":false,"joined":null,"note":null}],` +
+			`"orders":[{"no":1,"id":"o1","sku":"a"},{"no":2,"id":"o2","sku":"b"},{"no":3,"id":"o3","sku":"c"}]}`
+		tcases := []struct {
+			sel, want string
+		}{
+			{
+				sel:  "",
+				want: `{"$file":[{"email":"a@x.com","age":18,"vip":true,"joined":"2024-03-10T08:30:00Z","note":null},{"email":"b@x.com","age":20.5,"vip":false,"joined":null,"note":null}],` + sheets + `}`,
+			},
+			{
+				sel:  "orders!B1:C3",
+				want: `{"$file":[{"id":"o1","sku":"a"},{"id":"o2","sku":"b"}],` + sheets + `}`,
+			},
+			{
+				sel:  "orders!A:B",
+				want: `{"$file":[{"no":1,"id":"o1"},{"no":2,"id":"o2"},{"no":3,"id":"o3"}],` + sheets + `}`,
+			},
+			{
+				sel:  "none",
+				want: "",
+			},
+			{
+				sel:  "orders!C1:A3",
+				want: "",
+			},
+			{
+				sel:  "orders!ZZZZZZZZZZZZZZZ1:A2",
+				want: "",
+			},
+			{
+				sel:  "orders!A1:XFE3",
+				want: "",
+			},
+			{
+				sel:  "orders!A1:B1048577",
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			got, err := decodeExcel(excel, tc.sel)
+			if tc.want == "" && err == nil || tc.want != "" && got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s, err: %+v", tc.sel, tc.want, got, err)
+			}
+		}
+
+		bs, _ := decodeExcel(excel, "")
+		raw := `{"id":"@$sheets,orders,$range?limit=2,id"}`
+		des, _ := Decode(raw, []byte(bs))
+		if want := []string{`{"id":"o1"}`, `{"id":"o2"}`}; !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+
+		// 流式读取时逐行转为记录
+		src, err := newSheetSource(users, excelRange{toCol: 1, toRow: -1}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`{"email":"a@x.com","age":18}`, `{"email":"b@x.com","age":20.5}`} {
+			if rec, err := src.Next(); err != nil || string(rec) != want {
+				t.Errorf("Next ==> %s, but: %s, err: %+v", want, rec, err)
+			}
+		}
+		if _, err = src.Next(); err != io.EOF {
+			t.Errorf("Next ==> EOF, but: %+v", err)
+		}
+
+		dup := xlsx.NewFile()
+		sh, _ := dup.AddSheet("dup")
+		addRow(sh, "id", "name", "id")
+		addRow(sh, 1.0, "a", 2.0)
+		if _, err := decodeExcel(dup, ""); err == nil {
+			t.Errorf("duplicate column id, want err")
+		}
+		// 其他工作表出错时, 不在$sheets中, 不影响选择的工作表
+		ok, _ := dup.AddSheet("ok")
+		addRow(ok, "id")
+		addRow(ok, 1.0)
+		want := `{"$file":[{"id":1}],"$sheets":{"ok":[{"id":1}]}}`
+		if got, err := decodeExcel(dup, "ok"); err != nil || got != want {
+			t.Errorf("decode: ok, want: %s, got: %s, err: %+v", want, got, err)
+		}
+	})
+
+	t.Run("DecodeDataFile txt", func(t *testing.T) {
+		tcases := []struct {
+			file, want string
+		}{
+			{
+				file: write("ids.txt", "a\"b\n\"c\"\n\"d\n"),
+				want: `{"$file":["a\"b","c","\"d"]}`,
+			},
+			{
+				file: write("none.txt", ""),
+				want: `{"$file":[]}`,
+			},
+			{
+				file: "@" + filepath.Join(dir, "missing.txt"),
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			if got := DecodeDataFile(tc.file); got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.file, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("DecodeDataFile compressed", func(t *testing.T) {
+		compress := func(name, content string, w func(io.Writer) io.WriteCloser) string {
+			buf := &bytes.Buffer{}
+			zw := w(buf)
+			zw.Write([]byte(content))
+			zw.Close()
+			return write(name, buf.String())
+		}
+		gz := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+		zst := func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		}
+		os.Mkdir(filepath.Join(dir, "shards"), 0755)
+		tcases := []struct {
+			file, want string
+		}{
+			{
+				file: compress("ids.csv.gz", "id:int,name\n1,a\n2,b\n", gz),
+				want: `{"$file":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`,
+			},
+			{
+				file: compress("ids.jsonl.zst", "{\"id\": 1}\n{\"id\": 2}\n", zst),
+				want: `{"$file":[{"id":1},{"id":2}]}`,
+			},
+			{
+				file: compress("ids.txt.gz", "a\nb", gz),
+				want: `{"$file":["a","b"]}`,
+			},
+			{
+				file: compress("quote.txt.gz", "a\"b\n\"c\"\n\"d\n", gz),
+				want: `{"$file":["a\"b","c","\"d"]}`,
+			},
+			{
+				file: write("bad.csv.gz", "id\n1\n"),
+				want: "",
+			},
+			{
+				file: func() string {
+					write("shards/part-10.csv", "id:int\n3\n")
+					write("shards/part-02.csv", "id:int\n2\n")
+					compress("shards/part-01.csv.gz", "id:int\n1\n", gz)
+					write("shards/other.csv", "id:int\n0\n")
+					return "@" + filepath.Join(dir, "shards", "part-*.csv*")
+				}(),
+				want: `{"$file":[{"id":1},{"id":2},{"id":3}]}`,
+			},
+			{
+				file: "@" + filepath.Join(dir, "shards", "none-*.csv"),
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			if got := DecodeDataFile(tc.file); got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.file, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("DecodeDataFile sqlite", func(t *testing.T) {
+		file := filepath.Join(dir, "fixtures.db")
+		db, err := sql.Open("sqlite", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range []string{
+			"CREATE TABLE users (id INTEGER, name TEXT, score REAL, active INTEGER, note TEXT)",
+			"INSERT INTO users (id, name, score, active, note) VALUES (2, 'b', 1.5, 1, NULL), (1, 'a', 9, 1, 'x'), (3, 'c', 0, 0, NULL)",
+		} {
+			if _, err = db.Exec(it); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+
+		tcases := []struct {
+			file, want string
+		}{
+			{
+				file: "@sqlite:" + file + "?query=SELECT id,name FROM users WHERE active=1 ORDER BY id",
+				want: `{"$file":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`,
+			},
+			{
+				file: "@sqlite:" + file + "?query=SELECT id,score,note FROM users WHERE id=2",
+				want: `{"$file":[{"id":2,"score":1.5,"note":null}]}`,
+			},
+			{
+				file: "@sqlite:" + file + "?query=SELECT id FROM orders",
+				want: "",
+			},
+			{
+				file: "@sqlite:" + file,
+				want: "",
+			},
+			{
+				file: "@sqlite:" + filepath.Join(dir, "none.db") + "?query=SELECT id FROM users",
+				want: "",
+			},
+			{
+				file: "@sqlite:" + file + "?query=SELECT id,name,id FROM users",
+				want: "",
+			},
+		}
+		for _, tc := range tcases {
+			if got := DecodeDataFile(tc.file); got != tc.want {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.file, tc.want, got)
+			}
+		}
+
+		for _, v := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+			if got, err := sqlValue(v); err == nil {
+				t.Errorf("sqlValue: %v, want err, got: %s", v, got)
+			}
+		}
+		if _, err = os.Stat(filepath.Join(dir, "none.db")); !os.IsNotExist(err) {
+			t.Errorf("none.db should not be created, err: %+v", err)
+		}
+
+		raw := `{"user":"@$file,$range,name","i":"@$index"}`
+		des, _ := Decode(raw, []byte(DecodeDataFile(tcases[0].file)))
+		if want := []string{`{"user":"a","i":0}`, `{"user":"b","i":1}`}; !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+	})
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/sirupsen/logrus"
-	"github.com/tealeg/xlsx"
 	"github.com/toukii/goutils"
 	"github.com/toukii/jsnm"
 )
@@ -16,14 +19,19 @@ import (
 type iv map[string]interface{}
 
 var (
-	at      = "@"[0]
-	comma   = rune(","[0])
-	dblquot = rune(`"`[0])
-	dollar  = rune(`$`[0])
-	ranger  = "$range"
-	step    = "$step"
-	slice   = "$slice"
-	this    = "$this"
+	at         = "@"[0]
+	comma      = rune(","[0])
+	dblquot    = rune(`"`[0])
+	dollar     = rune(`$`[0])
+	query      = rune(`?`[0])
+	underscore = rune(`_`[0])
+	ranger     = "$range"
+	step       = "$step"
+	slice      = "$slice"
+	this       = "$this"
+	entries    = "$entries"
+	keys       = "$keys"
+	values     = "$values"
 
 	log *logrus.Entry
 )
@@ -51,6 +59,31 @@ type RangePath struct {
 	prefixPaths, suffixPaths []string
 	ranged, step, slice      bool // 是否循环, 是否range-step, slice切片
 	this                     bool
+	entries, keys, values    bool       // 按key排序遍历对象成员
+	params                   url.Values // 指令参数, 如 $range?limit=10&offset=5
+	directive                Directive  // RegisterDirective注册的指令
+}
+
+// splitDirective 拆分指令和参数: $range?limit=10 ==> $range, limit=10;
+// where的条件不转义, 须为最后一个参数: $range?limit=10&where=price * 2 > 10 && stock;
+// 占位符的路径以,分隔, 条件中不能含有, (如 cel:item.tags.exists(t, t == "a")), 其后的部分是$range之后的路径
+func splitDirective(it string) (string, url.Values) {
+	idx := strings.IndexRune(it, query)
+	if idx < 0 || !strings.HasPrefix(it, "$") {
+		return it, nil
+	}
+	qs, where := it[idx+1:], ""
+	if w := strings.Index(qs, "where="); w == 0 || (w > 0 && qs[w-1] == '&') {
+		qs, where = strings.TrimSuffix(qs[:w], "&"), qs[w+len("where="):]
+	}
+	params, err := url.ParseQuery(qs)
+	if err != nil {
+		log.Errorf("%s, err:%+v", it, err)
+	}
+	if where != "" {
+		params.Set("where", where)
+	}
+	return it[:idx], params
 }
 
 func TrimPath(paths []string) RangePath {
@@ -64,30 +97,19 @@ func TrimPath(paths []string) RangePath {
 	}
 
 	for i, it := range paths {
-		if it == ranger {
-			return RangePath{
-				prefixPaths: ret[:i],
-				suffixPaths: ret[i+1:],
-				ranged:      true,
-			}
-		} else if it == step {
-			return RangePath{
-				prefixPaths: ret[:i],
-				suffixPaths: ret[i+1:],
-				step:        true,
-			}
-		} else if it == slice {
-			return RangePath{
-				prefixPaths: ret[:i],
-				suffixPaths: ret[i+1:],
-				slice:       true,
-			}
-		} else if it == this {
-			return RangePath{
-				prefixPaths: ret[:i],
-				suffixPaths: ret[i+1:],
-				this:        true,
-			}
+		name, params := splitDirective(it)
+		r := RangePath{
+			prefixPaths: ret[:i],
+			suffixPaths: ret[i+1:],
+			params:      params,
+		}
+		if set, ok := builtins[name]; ok {
+			set(&r)
+			return r
+		}
+		if dir, ok := lookupDirective(name); ok {
+			r.directive = dir
+			return r
 		}
 	}
 
@@ -115,301 +137,346 @@ func decodeRange(js *jsnm.Jsnm, raw, pathStr string) ([]string, string) {
 	return ret, pathStr
 }
 
+// DecodeDataFile 读取数据文件的全部记录: {"$file":[...]}, 整个文件读入内存;
+// 大文件以OpenSource打开, 由DecodeSourceByChan逐条展开
 func DecodeDataFile(raw string) string {
 	if !strings.HasPrefix(raw, "@") {
 		return raw
 	}
-	if strings.HasSuffix(raw, ".xlsx") {
+	if strings.HasPrefix(raw[1:], sqlitePrefix) {
+		return DecodeDataSQLite(raw[1:])
+	}
+	if isGlob(raw[1:]) || isCompressed(raw) {
+		return DecodeDataSourceFile(raw[1:])
+	}
+	if strings.HasSuffix(raw, ".xlsx") || strings.Contains(raw, ".xlsx#") {
 		return DecodeDataExcelFile(string(raw[1:]))
 	}
-
-	bs := goutils.ReadFile(string(raw[1:]))
-	str := goutils.ToString(bs)
-
-	var ret string
-	if string(bs[0]) == `"` {
-		ret = strings.Replace(str, "\n", ",", -1)
-	} else {
-		as := strings.Split(str, "\n")
-		for i, _ := range as {
-			as[i] = fmt.Sprintf(`"%s"`, as[i])
-		}
-		ret = strings.Join(as, ",")
+	if strings.HasSuffix(raw, ".csv") {
+		return DecodeDataCSVFile(raw[1:])
 	}
-
-	ret = fmt.Sprintf(`{"$file":[%s]}`, ret)
-	// fmt.Printf("decode:%s ==> %s", raw, ret)
-	return ret
-}
-
-func DecodeDataExcelFile(filename string) string {
-	log.Infof("DecodeDataExcelFile %s ...", filename)
-	excel, err := xlsx.OpenFile(filename)
-	if err != nil {
-		panic(err)
-	}
-	cotxt := make([]string, 0, 1024)
-	for i, sh := range excel.Sheets {
-		log.Infof("DecodeDataExcelFile %s sheet %d ...", filename, i)
-		for j, r := range sh.Rows {
-			if j%1000 == 0 {
-				fmt.Printf("%d ", j)
-			}
-			if len(r.Cells) <= 0 {
-				continue
-			}
-			if string(r.Cells[0].Value[0]) == `"` {
-				cotxt = append(cotxt, r.Cells[0].Value)
-			} else {
-				cotxt = append(cotxt, fmt.Sprintf(`"%s"`, r.Cells[0].Value))
-			}
-		}
+	if strings.HasSuffix(raw, ".ndjson") || strings.HasSuffix(raw, ".jsonl") {
+		return DecodeDataNDJSONFile(raw[1:])
 	}
-	if len(cotxt) <= 0 {
-		return ""
+	if strings.HasSuffix(raw, ".json") {
+		return DecodeDataJSONFile(raw[1:])
 	}
 
-	ret := strings.Join(cotxt, ",")
-	ret = fmt.Sprintf(`{"$file":[%s]}`, ret)
-	// fmt.Printf("decode:%s ==> %s", raw, ret)
-	return ret
+	return DecodeDataLineFile(raw[1:])
 }
 
-func DecodeByChan(raw string, prebs []byte, ivkData chan string, dataEnd chan bool) ([]string, string) {
+func (d *Decoder) DecodeContextByChan(raw string, ctx *Context, ivkData chan string, dataEnd chan bool) ([]string, string) {
 	go func() {
 		if raw == "" {
 			ivkData <- ""
-			// return []string{""}, ""
 			dataEnd <- true
 			return
 		}
-		// raw = DecodeDataFile(raw)
-		ret := raw
-		js := jsnm.BytesFmt(prebs)
-		// log.Infof("raw:%+v %s, %+v", raw, prebs, js.RawData().Raw())
-		allpaths := subDecode(raw, true)
-		// log.Infof("allpaths:%+v", allpaths)
-		if len(allpaths) == 1 && allpaths[0] == "" {
-			ivkData <- strings.Replace(raw, `"@"`, goutils.ToString(prebs), 1)
-			// return []string{strings.Replace(raw, `"@"`, goutils.ToString(prebs), 1)}, allpaths[0]
-			dataEnd <- true
-			return
-		}
-		for _, it := range allpaths {
-			rawpaths := strings.Split(it, ",")
-			rangePaths := TrimPath(rawpaths)
-			size := len(rawpaths)
-			if size <= 0 {
-				continue
-			}
-			rawArrGet := js.ArrGet(rangePaths.prefixPaths...)
-			val := rawArrGet.RawData().Raw()
-			// log.Infof("data:%+v, %+v", rangePaths.prefixPaths, js.RawData().Raw())
-			// log.Infof("path:%s, val:%+v", it, val)
-			if val == nil {
-				continue
-			}
-			if rangePaths.ranged {
-				arr := rawArrGet.Arr()
-				retsize := len(arr)
-				ret := make([]string, retsize)
-				for i, item := range arr {
-					var v string
-					bs, err := jsonen(item.ArrGet(rangePaths.suffixPaths...).RawData().Raw())
-					if err == nil {
-						v = string(bs)
-					} else {
-						v = fmt.Sprint(item.ArrGet(rangePaths.suffixPaths...).RawData().Raw())
-					}
-
-					ivkData <- strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), v, 1)
-					ret[i] = strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), v, 1)
-				}
-				// return ret, it
-				dataEnd <- true
-				return
-			}
-			if rangePaths.step {
-				arr := rawArrGet.Arr()
-				retsize := len(arr)
-				if retsize < 2 {
-					// return []string{}, ""
-					dataEnd <- true
-					return
-				}
-				from := int32(arr[0].MustFloat64())
-				to := int32(arr[1].MustFloat64())
-				ret := make([]string, 0, int(to-from))
-				for i := from; i < to; i++ {
-					ivkData <- strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), fmt.Sprintf("%d", i), 1)
-					ret = append(ret, strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), fmt.Sprintf("%d", i), 1))
-				}
-				// return ret, it
-				dataEnd <- true
-				return
-			}
-			if rangePaths.slice {
-				arr := rawArrGet.Arr()
-				size := len(arr)
-				if size <= 0 {
-					// return []string{}, ""
-					dataEnd <- true
-					return
-				}
-				N := 100
-				remainder := 0 // 没有没整除的部分
-				if size%N > 0 {
-					remainder = 1
-				}
-				loop := size/N + remainder // 总共切片切次
-
-				ret := make([]string, 0, size)
-				ain := make([]string, N)
-				for idx := 0; idx < loop-1; idx++ {
-					tmp := arr[idx*N : (idx+1)*N]
-					for i, a := range tmp {
-						ain[i] = fmt.Sprintf(`"%s"`, a.Decode())
-					}
-					ivkData <- getContextByString(raw, it, strings.Join(ain, ","))
-					ret = append(ret, getContextByString(raw, it, strings.Join(ain, ",")))
-				}
-
-				ain1 := make([]string, 0, size)
-				tmp := arr[(loop-1)*N:]
-				for _, a := range tmp {
-					ain1 = append(ain1, fmt.Sprintf(`"%s"`, a.Decode()))
-				}
-				ivkData <- getContextByString(raw, it, strings.Join(ain1, ","))
-				ret = append(ret, getContextByString(raw, it, strings.Join(ain1, ",")))
-
-				// return ret, it
-				dataEnd <- true
-				return
-			}
-			if rangePaths.this {
-				// return
-			}
-			vv, typ := value(val)
-			if vv != "" {
-				if typ != "string" && strings.Contains(ret, fmt.Sprintf(`"@%s"`, it)) {
-					ret = strings.Replace(ret, fmt.Sprintf(`"@%s"`, it), fmt.Sprintf(`%s`, vv), -1)
-				}
-				ret = strings.Replace(ret, fmt.Sprintf(`"@%s`, it), fmt.Sprintf(`"%s`, vv), -1)
-			}
-		}
-		ivkData <- ret
-		// return []string{ret}, ""
+		d.generate(ctx, raw, nil, 100, func(out string) {
+			ivkData <- out
+		})
 		dataEnd <- true
-		return
-
 	}()
 	return []string{""}, ""
 }
 
-func Decode(raw string, prebs []byte) ([]string, string) {
+func (d *Decoder) DecodeContext(raw string, ctx *Context) ([]string, string) {
 	if raw == "" {
 		return []string{""}, ""
 	}
-	// raw = DecodeDataFile(raw)
-	ret := raw
-	js := jsnm.BytesFmt(prebs)
-	// log.Infof("raw:%+v %s, %+v", raw, prebs, js.RawData().Raw())
+	ret := make([]string, 0, 1)
+	it := d.generate(ctx, raw, nil, 2, func(out string) {
+		ret = append(ret, out)
+	})
+	return ret, it
+}
+
+// generate 展开模板, 每个输出调用emit, 返回展开的指令路径; batch为$slice每批的个数, outer为ctx之外的替换, 如流式读取的记录.
+// 占位符只取自模板, 所有的值一次替换到模板中, 替换进的值不会再被解析
+func (d *Decoder) generate(ctx *Context, raw string, outer *subst, batch int, emit func(string)) string {
+	raw = d.decodeIf(ctx, d.render(ctx, "pre_render", raw))
 	allpaths := subDecode(raw, true)
-	// log.Infof("allpaths:%+v", allpaths)
 	if len(allpaths) == 1 && allpaths[0] == "" {
-		return []string{strings.Replace(raw, `"@"`, goutils.ToString(prebs), 1)}, allpaths[0]
+		emit(strings.Replace(raw, `"@"`, goutils.ToString(ctx.defaultDoc()), 1))
+		return ""
 	}
+	base := outer.merge(nil)
+	pipes := make([]string, 0, len(allpaths))
+	// 第一个展开多个输出的指令
+	var dir string
+	var dirPaths RangePath
+	var dirVal *jsnm.Jsnm
 	for _, it := range allpaths {
-		rawpaths := strings.Split(it, ",")
-		rangePaths := TrimPath(rawpaths)
-		size := len(rawpaths)
-		if size <= 0 {
+		if _, ok := parsePipeline(it); ok {
+			// 函数管道最后由fill求值
+			pipes = append(pipes, it)
 			continue
 		}
-		rawArrGet := js.ArrGet(rangePaths.prefixPaths...)
+		it = ctx.trimDoc(it)
+		rangePaths := TrimPath(strings.Split(it, ","))
+		rawArrGet := d.get(ctx, rangePaths.prefixPaths...)
 		val := rawArrGet.RawData().Raw()
-		// log.Infof("data:%+v, %+v", rangePaths.prefixPaths, js.RawData().Raw())
-		// log.Infof("path:%s, val:%+v", it, val)
 		if val == nil {
 			continue
 		}
-		if rangePaths.ranged {
-			arr := rawArrGet.Arr()
-			retsize := len(arr)
-			ret := make([]string, retsize)
-			for i, item := range arr {
-				var v string
-				bs, err := jsonen(item.ArrGet(rangePaths.suffixPaths...).RawData().Raw())
-				if err == nil {
-					v = string(bs)
-				} else {
-					v = fmt.Sprint(item.ArrGet(rangePaths.suffixPaths...).RawData().Raw())
-				}
-
-				ret[i] = strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), v, 1)
+		if rangePaths.iterates() {
+			if dir == "" {
+				dir, dirPaths, dirVal = it, rangePaths, rawArrGet
 			}
-			return ret, it
+			continue
 		}
-		if rangePaths.step {
-			arr := rawArrGet.Arr()
-			retsize := len(arr)
-			if retsize < 2 {
-				return []string{}, ""
-			}
-			from := int32(arr[0].MustFloat64())
-			to := int32(arr[1].MustFloat64())
-			ret := make([]string, 0, int(to-from))
-			for i := from; i < to; i++ {
-				ret = append(ret, strings.Replace(raw, fmt.Sprintf(`"@%s"`, it), fmt.Sprintf("%d", i), 1))
+		base.plain(it, val)
+	}
+	if dir == "" {
+		emit(d.fill(ctx, raw, base, pipes))
+		return ""
+	}
+	for _, item := range d.iterate(ctx, dir, dirVal, dirPaths, batch) {
+		emit(d.fill(ctx, raw, base.merge(item), pipes))
+	}
+	return dir
+}
+
+// iterates 是否为展开多个输出的指令
+func (r RangePath) iterates() bool {
+	return r.ranged || r.step || r.slice || r.entries || r.keys || r.values || r.directive != nil
+}
+
+// iterate 返回指令展开的每个输出中的替换
+func (d *Decoder) iterate(ctx *Context, it string, js *jsnm.Jsnm, rangePaths RangePath, batch int) []*subst {
+	placeholder := quote("@" + it)
+	switch {
+	case rangePaths.ranged:
+		arr := js.Arr()
+		idxs := d.rangeIdxs(ctx, arr, rangePaths.params)
+		ret := make([]*subst, len(idxs))
+		for i, idx := range idxs {
+			item := arr[idx].ArrGet(rangePaths.suffixPaths...).RawData().Raw()
+			v := fmt.Sprint(item)
+			if bs, err := jsonen(item); err == nil {
+				v = string(bs)
 			}
-			return ret, it
+			ret[i] = iterMeta(i, len(idxs), -1)
+			ret[i].add(placeholder, v, 1)
+		}
+		return ret
+	case rangePaths.step:
+		arr := js.Arr()
+		if len(arr) < 2 {
+			return nil
 		}
-		if rangePaths.slice {
-			arr := rawArrGet.Arr()
-			size := len(arr)
-			if size <= 0 {
-				return []string{}, ""
+		if times, ok := stepTimes(arr, rangePaths.params); ok {
+			ret := make([]*subst, len(times))
+			for i, t := range times {
+				ret[i] = iterMeta(i, len(times), -1)
+				ret[i].add(placeholder, t, 1)
 			}
-			N := 2
-			remainder := 0 // 没有没整除的部分
-			if size%N > 0 {
-				remainder = 1
+			return ret
+		}
+		from := int32(arr[0].MustFloat64())
+		to := int32(arr[1].MustFloat64())
+		if to < from {
+			log.Errorf("%s: %d is less than %d", it, to, from)
+			return nil
+		}
+		ret := make([]*subst, 0, int(to-from))
+		for i := from; i < to; i++ {
+			item := iterMeta(int(i-from), int(to-from), -1)
+			item.add(placeholder, fmt.Sprintf("%d", i), 1)
+			ret = append(ret, item)
+		}
+		return ret
+	case rangePaths.slice:
+		arr := js.Arr()
+		size := len(arr)
+		if size <= 0 {
+			return nil
+		}
+		loop := (size + batch - 1) / batch // 总共切片切次
+		ret := make([]*subst, 0, loop)
+		for idx := 0; idx < loop; idx++ {
+			end := (idx + 1) * batch
+			if end > size {
+				end = size
 			}
-			loop := size/N + remainder // 总共切片切次
-
-			ret := make([]string, 0, size)
-			ain := make([]string, N)
-			for idx := 0; idx < loop-1; idx++ {
-				tmp := arr[idx*N : (idx+1)*N]
-				for i, a := range tmp {
-					ain[i] = fmt.Sprintf(`"%s"`, a.Decode())
-				}
-				ret = append(ret, getContextByString(raw, it, strings.Join(ain, ",")))
+			ain := make([]string, 0, batch)
+			for _, a := range arr[idx*batch : end] {
+				ain = append(ain, fmt.Sprintf(`"%s"`, a.Decode()))
 			}
+			item := iterMeta(idx, loop, idx)
+			item.add(placeholder, strings.Join(ain, ","), 1)
+			ret = append(ret, item)
+		}
+		return ret
+	case rangePaths.entries || rangePaths.keys || rangePaths.values:
+		return decodeMembers(it, js, rangePaths)
+	}
+	return expand(it, js, rangePaths)
+}
 
-			ain1 := make([]string, 0, size)
-			tmp := arr[(loop-1)*N:]
-			for _, a := range tmp {
-				ain1 = append(ain1, fmt.Sprintf(`"%s"`, a.Decode()))
-			}
-			ret = append(ret, getContextByString(raw, it, strings.Join(ain1, ",")))
+// decodeMembers 按key排序遍历对象成员, 模板中可使用@$key, @$value
+func decodeMembers(pathStr string, js *jsnm.Jsnm, rangePaths RangePath) []*subst {
+	m, ok := js.RawData().Raw().(map[string]interface{})
+	if !ok {
+		log.Errorf("%s: not an object", pathStr)
+		return nil
+	}
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
 
-			return ret, it
+	idxs, err := pick(len(names), rangePaths.params)
+	if err != nil {
+		log.Errorf("%s, err:%+v", pathStr, err)
+		return nil
+	}
+	ret := make([]*subst, 0, len(idxs))
+	for i, idx := range idxs {
+		k := names[idx]
+		val := js.ArrGet(k).ArrGet(rangePaths.suffixPaths...).RawData().Raw()
+		var v interface{}
+		switch {
+		case rangePaths.keys:
+			v = k
+		case rangePaths.values:
+			v = val
+		default:
+			v = iv{"key": k, "value": val}
 		}
-		vv, typ := value(val)
-		fmt.Println(rangePaths, vv)
-		fmt.Println(val)
-		if rangePaths.this {
-			return []string{strings.Replace(ret, fmt.Sprintf(`"@%s"`, this), fmt.Sprintf(`%s`, vv), -1)}, ""
+		bs, err := jsonen(v)
+		if err != nil {
+			log.Errorf("%s: %+v, err:%+v", pathStr, v, err)
+			continue
+		}
+		item := iterMeta(i, len(idxs), -1)
+		item.add(quote("@"+pathStr), string(bs), 1)
+		item.set("$key", k, -1)
+		item.set("$value", val, -1)
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+// rangeIdxs 返回$range保留的下标: 先保留满足where条件的元素, 再按pick选取;
+// 条件中不带文档名的路径取自元素: $range?where=price > 10 && !@vars:skip;
+// cel:开头的条件中以item引用元素: $range?where=cel:item.price > 10
+func (d *Decoder) rangeIdxs(ctx *Context, arr []*jsnm.Jsnm, params url.Values) []int {
+	where := params.Get("where")
+	kept := make([]int, 0, len(arr))
+	for i, it := range arr {
+		if where == "" {
+			kept = append(kept, i)
+			continue
 		}
-		if vv != "" {
-			if typ != "string" && strings.Contains(ret, fmt.Sprintf(`"@%s"`, it)) {
-				ret = strings.Replace(ret, fmt.Sprintf(`"@%s"`, it), fmt.Sprintf(`%s`, vv), -1)
+		if expr, ok := isCel(where); ok {
+			if d.evalCel(ctx, expr, it.RawData().Raw()) {
+				kept = append(kept, i)
 			}
-			ret = strings.Replace(ret, fmt.Sprintf(`"@%s`, it), fmt.Sprintf(`"%s`, vv), -1)
+			continue
+		}
+		bs, err := jsonen(it.RawData().Raw())
+		if err != nil {
+			log.Errorf("%s, err:%+v", where, err)
+			continue
+		}
+		if d.evalCond(ctx.fork(bs), where) {
+			kept = append(kept, i)
+		}
+	}
+	idxs, err := pick(len(kept), params)
+	if err != nil {
+		log.Errorf("$range, err:%+v", err)
+		return nil
+	}
+	for i, idx := range idxs {
+		idxs[i] = kept[idx]
+	}
+	return idxs
+}
+
+// pick 返回$range保留的下标, 依次应用 offset, every, sample, limit; 参数无效时出错, 不保留任何元素
+func pick(size int, params url.Values) ([]int, error) {
+	offset, every, sample, limit, err := rangeParams(params)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int, 0, size)
+	for i := offset; i < size; i += every {
+		ret = append(ret, i)
+	}
+	if sample >= 0 && sample < len(ret) {
+		rnd := rand.New(rand.NewSource(int64(intParam(params, "seed", 1))))
+		perm := rnd.Perm(len(ret))[:sample]
+		sort.Ints(perm)
+		sampled := make([]int, sample)
+		for i, p := range perm {
+			sampled[i] = ret[p]
 		}
+		ret = sampled
 	}
-	return []string{ret}, ""
+	if limit >= 0 && limit < len(ret) {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// rangeParams $range的 offset, every, sample, limit 参数, 未设置时为默认值; sample, limit 为-1时不限
+func rangeParams(params url.Values) (offset, every, sample, limit int, err error) {
+	if offset, err = boundParam(params, "offset", 0, 0); err != nil {
+		return
+	}
+	if every, err = boundParam(params, "every", 1, 1); err != nil {
+		return
+	}
+	if sample, err = boundParam(params, "sample", -1, 0); err != nil {
+		return
+	}
+	limit, err = boundParam(params, "limit", -1, -1)
+	return
+}
+
+func intParam(params url.Values, key string, def int) int {
+	v := params.Get(key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Errorf("%s=%s, err:%+v", key, v, err)
+		return def
+	}
+	return i
+}
+
+// boundParam 整数参数, 未设置时为def; 不是整数或小于min时出错: offset=-1
+func boundParam(params url.Values, key string, def, min int) (int, error) {
+	v := params.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s=%s is not an integer", key, v)
+	}
+	if i < min {
+		return 0, fmt.Errorf("%s=%d, should be >= %d", key, i, min)
+	}
+	return i, nil
+}
+
+// iterMeta 迭代的元信息: @$index, @$count, @$first, @$last, $slice的批次@$batch
+func iterMeta(index, count, batch int) *subst {
+	s := &subst{}
+	s.set("$index", index, -1)
+	s.set("$count", count, -1)
+	s.set("$first", index == 0, -1)
+	s.set("$last", index == count-1, -1)
+	if batch >= 0 {
+		s.set("$batch", batch, -1)
+	}
+	return s
 }
 
 func getContext(raw, _path string, i int64) string {
@@ -450,9 +517,15 @@ func decodeMap(raw interface{}) []string {
 	if !ok {
 		return nil
 	}
+	// 按key排序, 使生成函数按固定的顺序使用随机数
+	names := make([]string, 0, len(vs))
+	for k := range vs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
 	ret := make([]string, 0, 1)
-	for _, subit := range vs {
-		if subret := subDecode(subit, false); len(subret) > 0 {
+	for _, k := range names {
+		if subret := subDecode(vs[k], false); len(subret) > 0 {
 			ret = append(ret, subret...)
 		}
 	}
@@ -511,8 +584,35 @@ func getLetterStr(bs []byte) (string, bool) {
 	}
 	rs := bytes.Runes(bs)
 	size := len(rs)
+	if size > 1 && rs[1] == lbrace {
+		// 表达式: @{page + 1}
+		if end := closeDelim(rs, 1, lbrace, rbrace); end > 1 {
+			return string(rs[1 : end+1]), true
+		}
+	}
+	seg := 1 // 当前路径段的起始位置
 	for i := 1; i < size; i++ {
-		if unicode.IsLetter(rs[i]) || unicode.IsNumber(rs[i]) || rs[i] == comma || rs[i] == dblquot || rs[i] == dollar {
+		if rs[i] == query && rs[seg] == dollar {
+			// 指令参数一直到字符串结尾: @vals,$range?limit=10&offset=5
+			return goutils.ToString(bs[1:]), true
+		}
+		if rs[i] == lparen && rs[seg] == dollar {
+			// 生成函数的参数: @$rand_int(1,100)
+			if end := closeParen(rs, i); end > i {
+				i = end
+				continue
+			}
+		}
+		if rs[i] == pipe {
+			// 函数管道: @vals|sort|first
+			if end := scanPipes(rs, i); end > i {
+				return string(rs[1:end]), true
+			}
+		}
+		if rs[i] == comma {
+			seg = i + 1
+		}
+		if unicode.IsLetter(rs[i]) || unicode.IsNumber(rs[i]) || rs[i] == comma || rs[i] == dblquot || rs[i] == dollar || rs[i] == underscore || (rs[i] == colon && seg == 1) {
 			continue
 		}
 		return goutils.ToString(bs[1:i]), true
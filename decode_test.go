@@ -1,6 +1,7 @@
 package jdecode
 
 import (
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -256,6 +257,51 @@ func TestDecodeRange(t *testing.T) {
 				bs:  []byte(`[{"name":"katasi"},{"name":"katasiki"},{"name":"kataji"}]`),
 				des: []string{`{"val":"katasi"}`, `{"val":"katasiki"}`, `{"val":"kataji"}`},
 			},
+			{
+				raw: `{"val":"@vals,$range?limit=2"}`,
+				bs:  []byte(`{"vals":[1,2,3,4,5]}`),
+				des: []string{`{"val":1}`, `{"val":2}`},
+			},
+			{
+				raw: `{"val":"@vals,$range?offset=1&every=2"}`,
+				bs:  []byte(`{"vals":[1,2,3,4,5]}`),
+				des: []string{`{"val":2}`, `{"val":4}`},
+			},
+			{
+				raw: `{"val":"@vals,$range?offset=3&limit=5"}`,
+				bs:  []byte(`{"vals":[1,2,3,4,5]}`),
+				des: []string{`{"val":4}`, `{"val":5}`},
+			},
+			{
+				raw: `{"val":"@vals,$range?sample=2&seed=7"}`,
+				bs:  []byte(`{"vals":[1,2,3,4,5]}`),
+				des: []string{`{"val":1}`, `{"val":3}`},
+			},
+			{
+				raw: `{"val":"@vals,$range?offset=-1&limit=-2&sample=-3&every=0"}`,
+				bs:  []byte(`{"vals":[1,2,3]}`),
+				des: []string{},
+			},
+			{
+				raw: `{"val":"@vals,$range?limit=ten"}`,
+				bs:  []byte(`{"vals":[1,2,3]}`),
+				des: []string{},
+			},
+			{
+				raw: `{"val":"@vals,$range?limit=-2"}`,
+				bs:  []byte(`{"vals":[1,2,3]}`),
+				des: []string{},
+			},
+			{
+				raw: `{"val":"@vals,$range?every=0"}`,
+				bs:  []byte(`{"vals":[1,2,3]}`),
+				des: []string{},
+			},
+			{
+				raw: `{"val":"@vals,$range?limit=-1"}`,
+				bs:  []byte(`{"vals":[1,2,3]}`),
+				des: []string{`{"val":1}`, `{"val":2}`, `{"val":3}`},
+			},
 		}
 		size := len(tcases)
 		for i := 0; i < size; i++ {
@@ -340,6 +386,87 @@ func TestDecodeThis(t *testing.T) {
 	})
 }
 
+func TestDecodeMeta(t *testing.T) {
+	t.Run("Decode $index", func(t *testing.T) {
+		tcases := []testcase{
+			{
+				raw: `{"val":"@vals,$range","seq":"@$index","key":"@$index-k","first":"@$first","last":"@$last","count":"@$count"}`,
+				bs:  []byte(`{"vals":["a","b"]}`),
+				des: []string{`{"val":"a","seq":0,"key":"0-k","first":true,"last":false,"count":2}`, `{"val":"b","seq":1,"key":"1-k","first":false,"last":true,"count":2}`},
+			},
+			{
+				raw: `{"page":"@$step","seq":"@$index"}`,
+				bs:  []byte(`[5,7]`),
+				des: []string{`{"page":5,"seq":0}`, `{"page":6,"seq":1}`},
+			},
+			{
+				raw: `{"ids":["@$slice"],"batch":"@$batch","last":"@$last"}`,
+				bs:  []byte(`[3,2,6]`),
+				des: []string{`{"ids":["3","2"],"batch":0,"last":false}`, `{"ids":["6"],"batch":1,"last":true}`},
+			},
+			{
+				raw: `{"val":"@vals,$range","seq":"@$index"}`,
+				bs:  []byte(`{"vals":["@$index",{"k":"@$count-x"}]}`),
+				des: []string{`{"val":"@$index","seq":0}`, `{"val":{"k":"@$count-x"},"seq":1}`},
+			},
+		}
+		size := len(tcases)
+		for i := 0; i < size; i++ {
+			des, _ := Decode(tcases[i].raw, tcases[i].bs)
+			if !reflect.DeepEqual(des, tcases[i].des) {
+				t.Errorf("decode: %s, want: %s, got: %s", tcases[i].raw, tcases[i].des, des)
+			} else {
+				for j, it := range des {
+					log.Debugf("%d decode, raw: %s bs: %s ==> %s", j, tcases[i].raw, tcases[i].bs, it)
+				}
+			}
+		}
+	})
+}
+
+func TestDecodeEntries(t *testing.T) {
+	t.Run("Decode $entries", func(t *testing.T) {
+		tcases := []testcase{
+			{
+				raw: `{"quota":"@quotas,$entries"}`,
+				bs:  []byte(`{"quotas":{"disk":{"max":10},"cpu":{"max":4}}}`),
+				des: []string{`{"quota":{"key":"cpu","value":{"max":4}}}`, `{"quota":{"key":"disk","value":{"max":10}}}`},
+			},
+			{
+				raw: `{"name":"@quotas,$keys","max":"@$value","id":"@$key-1"}`,
+				bs:  []byte(`{"quotas":{"disk":10,"cpu":4}}`),
+				des: []string{`{"name":"cpu","max":4,"id":"cpu-1"}`, `{"name":"disk","max":10,"id":"disk-1"}`},
+			},
+			{
+				raw: `{"max":"@quotas,$values,max","name":"@$key","seq":"@$index"}`,
+				bs:  []byte(`{"quotas":{"disk":{"max":10},"cpu":{"max":4},"mem":{"max":8}}}`),
+				des: []string{`{"max":4,"name":"cpu","seq":0}`, `{"max":10,"name":"disk","seq":1}`, `{"max":8,"name":"mem","seq":2}`},
+			},
+			{
+				raw: `{"name":"@quotas,$keys?offset=1&limit=1"}`,
+				bs:  []byte(`{"quotas":{"disk":10,"cpu":4,"mem":8}}`),
+				des: []string{`{"name":"disk"}`},
+			},
+			{
+				raw: `{"quota":"@quotas,$values","id":"@$value-x","key":"@$key"}`,
+				bs:  []byte(`{"quotas":{"disk":{"max":"@$key"}}}`),
+				des: []string{`{"quota":{"max":"@$key"},"id":"{\"max\":\"@$key\"}-x","key":"disk"}`},
+			},
+		}
+		size := len(tcases)
+		for i := 0; i < size; i++ {
+			des, _ := Decode(tcases[i].raw, tcases[i].bs)
+			if !reflect.DeepEqual(des, tcases[i].des) {
+				t.Errorf("decode: %s, want: %s, got: %s", tcases[i].raw, tcases[i].des, des)
+			} else {
+				for j, it := range des {
+					log.Debugf("%d decode, raw: %s bs: %s ==> %s", j, tcases[i].raw, tcases[i].bs, it)
+				}
+			}
+		}
+	})
+}
+
 func TestGetLetterStr(t *testing.T) {
 	t.Run("getLetterStr", func(t *testing.T) {
 		ts := [][2]string{
@@ -352,6 +479,12 @@ func TestGetLetterStr(t *testing.T) {
 			[2]string{`@msg,0,"1",count`, `msg,0,"1",count`},
 			[2]string{`@langs,0,name`, `langs,0,name`},
 			[2]string{`@@langs,0,name`, ``},
+			[2]string{`@vals,$range?limit=10&offset=5`, `vals,$range?limit=10&offset=5`},
+			[2]string{`@vals?limit=10`, `vals`},
+			[2]string{`@vals|sort('a b')|first!`, `vals|sort('a b')|first`},
+			[2]string{`@vals|!`, `vals`},
+			[2]string{`@create_order:id,0!`, `create_order:id,0`},
+			[2]string{`@id,0:1`, `id,0`},
 		}
 		for _, it := range ts {
 			str, ok := getLetterStr([]byte(it[0]))
@@ -467,3 +600,35 @@ func sliceEqual(sl1, sl2 []string) bool {
 	}
 	return true
 }
+
+func TestDecodeInjection(t *testing.T) {
+	os.Setenv("JDECODE_TEST_SECRET", "TopSecret")
+	defer os.Unsetenv("JDECODE_TEST_SECRET")
+
+	t.Run("Decode response placeholders", func(t *testing.T) {
+		bs := []byte(`{"evil":"@$env,JDECODE_TEST_SECRET|lower","vals":["@$env,JDECODE_TEST_SECRET|lower","@$uuid"],"id":"@evil"}`)
+		tcases := []testcase{
+			{
+				raw: `{"a":"@evil"}`,
+				bs:  bs,
+				des: []string{`{"a":"@$env,JDECODE_TEST_SECRET|lower"}`},
+			},
+			{
+				raw: `{"a":"@vals,$range","n":"@vals|len"}`,
+				bs:  bs,
+				des: []string{`{"a":"@$env,JDECODE_TEST_SECRET|lower","n":2}`, `{"a":"@$uuid","n":2}`},
+			},
+			{
+				raw: `{"a":"@evil","b":"@id"}`,
+				bs:  bs,
+				des: []string{`{"a":"@$env,JDECODE_TEST_SECRET|lower","b":"@evil"}`},
+			},
+		}
+		for _, tc := range tcases {
+			des, _ := Decode(tc.raw, tc.bs)
+			if !reflect.DeepEqual(des, tc.des) {
+				t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+			}
+		}
+	})
+}
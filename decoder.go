@@ -0,0 +1,128 @@
+package jdecode
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/toukii/jsnm"
+	"go.starlark.net/starlark"
+)
+
+// Decoder 保存生成函数的状态: 随机数和计数器, 以及@$env使用的profile;
+// 使用相同seed的Decoder生成相同的数据, 便于复现
+type Decoder struct {
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	seqs    map[string]int64
+	clock   func() time.Time // @$now使用的时钟
+	profile *jsnm.Jsnm       // UseProfile选择的变量
+	steps   uint64           // 脚本的最大执行步数
+	hooks   string           // UseScript设置的渲染钩子脚本
+	scripts map[string]starlark.StringDict
+}
+
+// std 包级别的Decode, DecodeByChan使用的Decoder
+var std = NewDecoder(time.Now().UnixNano())
+
+func NewDecoder(seed int64) *Decoder {
+	return &Decoder{
+		rnd:     rand.New(rand.NewSource(seed)),
+		seqs:    make(map[string]int64),
+		clock:   time.Now,
+		steps:   maxSteps,
+		scripts: make(map[string]starlark.StringDict),
+	}
+}
+
+func Decode(raw string, prebs []byte) ([]string, string) {
+	return std.Decode(raw, prebs)
+}
+
+func DecodeByChan(raw string, prebs []byte, ivkData chan string, dataEnd chan bool) ([]string, string) {
+	return std.DecodeByChan(raw, prebs, ivkData, dataEnd)
+}
+
+func DecodeContext(raw string, ctx *Context) ([]string, string) {
+	return std.DecodeContext(raw, ctx)
+}
+
+func DecodeContextByChan(raw string, ctx *Context, ivkData chan string, dataEnd chan bool) ([]string, string) {
+	return std.DecodeContextByChan(raw, ctx, ivkData, dataEnd)
+}
+
+// Decode 以prebs为默认文档解析模板
+func (d *Decoder) Decode(raw string, prebs []byte) ([]string, string) {
+	return d.DecodeContext(raw, NewContext(prebs))
+}
+
+func (d *Decoder) DecodeByChan(raw string, prebs []byte, ivkData chan string, dataEnd chan bool) ([]string, string) {
+	return d.DecodeContextByChan(raw, NewContext(prebs), ivkData, dataEnd)
+}
+
+// fill 求值模板中的函数管道pipes, 与s中的值一次替换到模板中; 迭代生成的每个模板各自求值, 如每个请求各自的@$uuid;
+// 同一个管道出现多次时只求值一次, 各处的值相同. 管道只取自模板, 响应数据中的占位符不会被求值.
+// 然后调用post_render钩子, 对请求体的签名@$body最后求值
+func (d *Decoder) fill(ctx *Context, raw string, s *subst, pipes []string) string {
+	var signs []string
+	s = s.merge(nil)
+	seen := make(map[string]bool, len(pipes))
+	for _, it := range pipes {
+		if seen[it] {
+			continue
+		}
+		seen[it] = true
+		p, _ := parsePipeline(it)
+		if p.gen != nil && p.gen.name == body {
+			signs = append(signs, it)
+			continue
+		}
+		val, err := p.eval(d, ctx)
+		if err != nil {
+			log.Errorf("%s, err:%+v", it, err)
+			continue
+		}
+		if val != nil {
+			s.set(it, val, -1)
+		}
+	}
+	raw = d.render(ctx, "post_render", s.apply(raw))
+	if len(signs) > 0 {
+		raw = d.sign(ctx, raw, signs)
+	}
+	return raw
+}
+
+// Intn 加锁使用Decoder的随机数
+func (d *Decoder) Intn(n int) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rnd.Intn(n)
+}
+
+// between 加锁返回[min, max]中的随机数, min, max为int64的边界时也不溢出
+func (d *Decoder) between(min, max int64) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := uint64(max) - uint64(min)
+	switch {
+	case n < math.MaxInt32:
+		return min + int64(d.rnd.Intn(int(n)+1))
+	case n < math.MaxInt64:
+		return min + d.rnd.Int63n(int64(n)+1)
+	}
+	for {
+		if u := d.rnd.Uint64(); u <= n {
+			return int64(uint64(min) + u)
+		}
+	}
+}
+
+// Next 返回name的下一个序号, 从1开始
+func (d *Decoder) Next(name string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seqs[name]++
+	return d.seqs[name]
+}
@@ -0,0 +1,100 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toukii/jsnm"
+	"gopkg.in/yaml.v3"
+)
+
+// env 环境变量: @$env,TENANT_ID
+const env = "$env"
+
+// UseProfile 从json或yaml文件中选择名为name的一组变量, 文件格式为:
+//
+//	dev:
+//	  TENANT_ID: t-dev
+//	staging:
+//	  TENANT_ID: t-stg
+//
+// @$env,KEY 优先使用profile中的变量, 没有时使用环境变量
+func (d *Decoder) UseProfile(file, name string) error {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	profiles := make(map[string]map[string]interface{})
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bs, &profiles)
+	default:
+		err = json.Unmarshal(bs, &profiles)
+	}
+	if err != nil {
+		return fmt.Errorf("profile %s: %+v", file, err)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found in %s", name, file)
+	}
+	if bs, err = jsonen(profile); err != nil {
+		return fmt.Errorf("profile %s: %+v", file, err)
+	}
+	d.mu.Lock()
+	d.profile = jsnm.BytesFmt(bs)
+	d.mu.Unlock()
+	return nil
+}
+
+func UseProfile(file, name string) error {
+	return std.UseProfile(file, name)
+}
+
+// env 取变量paths[0], profile中没有时取环境变量; paths为空时返回所有的变量
+func (d *Decoder) env(paths ...string) *jsnm.Jsnm {
+	if len(paths) <= 0 {
+		return d.envDoc()
+	}
+	d.mu.Lock()
+	profile := d.profile
+	d.mu.Unlock()
+	if profile != nil {
+		if v := profile.ArrGet(paths[0]); v.RawData().Raw() != nil {
+			return v.ArrGet(paths[1:]...)
+		}
+	}
+	if v, ok := os.LookupEnv(paths[0]); ok && len(paths) == 1 {
+		return jsnm.BytesFmt([]byte(quote(v)))
+	}
+	return jsnm.BytesFmt([]byte("null"))
+}
+
+// envDoc 环境变量和profile中的变量
+func (d *Decoder) envDoc() *jsnm.Jsnm {
+	vars := make(map[string]interface{})
+	for _, it := range os.Environ() {
+		if kv := strings.SplitN(it, "=", 2); len(kv) == 2 {
+			vars[kv[0]] = kv[1]
+		}
+	}
+	d.mu.Lock()
+	profile := d.profile
+	d.mu.Unlock()
+	if profile != nil {
+		if m, ok := profile.RawData().Raw().(map[string]interface{}); ok {
+			for k, v := range m {
+				vars[k] = v
+			}
+		}
+	}
+	bs, err := jsonen(vars)
+	if err != nil {
+		log.Errorf("$env: %+v", err)
+	}
+	return jsnm.BytesFmt(bs)
+}
@@ -0,0 +1,60 @@
+package jdecode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeEnv(t *testing.T) {
+	os.Setenv("JDECODE_TENANT_ID", "t-env")
+	os.Setenv("JDECODE_HOST", "env.local")
+	os.Unsetenv("JDECODE_TEST_UNSET_PORT")
+	defer os.Unsetenv("JDECODE_TENANT_ID")
+	defer os.Unsetenv("JDECODE_HOST")
+
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	yml := filepath.Join(dir, "profiles.yaml")
+	ioutil.WriteFile(yml, []byte("dev:\n  JDECODE_TENANT_ID: t-dev\n  JDECODE_TEST_UNSET_PORT: 8080\nstaging:\n  JDECODE_TENANT_ID: t-stg\n"), 0644)
+	js := filepath.Join(dir, "profiles.json")
+	ioutil.WriteFile(js, []byte(`{"staging":{"JDECODE_TENANT_ID":"t-stg"}}`), 0644)
+
+	raw := `{"tenant":"@$env,JDECODE_TENANT_ID","host":"@$env,JDECODE_HOST|upper","port":"@$env,JDECODE_TEST_UNSET_PORT"}`
+	t.Run("Decode $env", func(t *testing.T) {
+		d := NewDecoder(1)
+		des, _ := d.Decode(raw, nil)
+		want := []string{`{"tenant":"t-env","host":"ENV.LOCAL","port":"@$env,JDECODE_TEST_UNSET_PORT"}`}
+		if !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+	})
+
+	t.Run("Decode profile", func(t *testing.T) {
+		tcases := []struct {
+			file, name string
+			des        []string
+		}{
+			{yml, "dev", []string{`{"tenant":"t-dev","host":"ENV.LOCAL","port":8080}`}},
+			{js, "staging", []string{`{"tenant":"t-stg","host":"ENV.LOCAL","port":"@$env,JDECODE_TEST_UNSET_PORT"}`}},
+		}
+		for _, tc := range tcases {
+			d := NewDecoder(1)
+			if err := d.UseProfile(tc.file, tc.name); err != nil {
+				t.Fatal(err)
+			}
+			des, _ := d.Decode(raw, nil)
+			if !reflect.DeepEqual(des, tc.des) {
+				t.Errorf("decode: %s with %s, want: %s, got: %s", raw, tc.name, tc.des, des)
+			}
+		}
+		if err := NewDecoder(1).UseProfile(yml, "prod"); err == nil {
+			t.Errorf("UseProfile %s prod, want err", yml)
+		}
+	})
+}
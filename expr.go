@@ -0,0 +1,367 @@
+package jdecode
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	lbrace = rune("{"[0])
+	rbrace = rune("}"[0])
+)
+
+// expr 占位符中的表达式: @{page + 1}, @{total - used}, @{price * 1.1 | round(2)}
+// 标识符为用.分隔的路径, 可带文档名: data.total, login:user.id;
+// 支持 + - * / % 比较 == != < <= > >= 逻辑 && || ! 和括号;
+// 算术只接受数字, + 也可以拼接两个字符串; 不存在的路径为null
+type expr interface {
+	eval(d *Decoder, ctx *Context) (interface{}, error)
+}
+
+type litExpr struct {
+	v interface{}
+}
+
+type identExpr struct {
+	name string
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+// binary 运算符的优先级, 越大越先计算
+var binary = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// parseExpr 解析表达式
+func parseExpr(s string) (expr, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	x, err := p.parse(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %s in %s", p.toks[p.pos].s, s)
+	}
+	return x, nil
+}
+
+// evalExpr 解析并求值表达式
+func (d *Decoder) evalExpr(ctx *Context, s string) (interface{}, error) {
+	x, err := parseExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	return x.eval(d, ctx)
+}
+
+type token struct {
+	kind rune // 'n'数字, 's'字符串, 'i'标识符, 'o'运算符
+	s    string
+	v    interface{}
+}
+
+func lex(s string) ([]token, error) {
+	rs := []rune(s)
+	toks := make([]token, 0, 8)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			// 指数: 2e3, 2e-3, 1.5E+2
+			if k := j + 1; k < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+				if (rs[k] == '+' || rs[k] == '-') && k+1 < len(rs) {
+					k++
+				}
+				if unicode.IsDigit(rs[k]) {
+					for j = k; j < len(rs) && unicode.IsDigit(rs[j]); j++ {
+					}
+				}
+			}
+			f, err := strconv.ParseFloat(string(rs[i:j]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %s", string(rs[i:j]))
+			}
+			toks = append(toks, token{kind: 'n', s: string(rs[i:j]), v: f})
+			i = j
+		case r == sglquot || r == dblquot:
+			j := i + 1
+			buf := &strings.Builder{}
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				buf.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated string in %s", s)
+			}
+			toks = append(toks, token{kind: 's', s: string(rs[i : j+1]), v: buf.String()})
+			i = j + 1
+		case unicode.IsLetter(r) || r == underscore || r == dollar || r == rune(at):
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || strings.ContainsRune("_$.:", rs[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: 'i', s: strings.TrimPrefix(string(rs[i:j]), "@")})
+			i = j
+		default:
+			op := string(r)
+			if i+1 < len(rs) {
+				if two := string(rs[i : i+2]); binary[two] > 0 {
+					op = two
+				}
+			}
+			if binary[op] == 0 && !strings.Contains("!()", op) {
+				return nil, fmt.Errorf("unexpected %s in %s", op, s)
+			}
+			toks = append(toks, token{kind: 'o', s: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	toks []token
+	pos  int
+}
+
+// parse 解析优先级不低于prec的二元表达式
+func (p *exprParser) parse(prec int) (expr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.toks) {
+		op := p.toks[p.pos]
+		if op.kind != 'o' || binary[op.s] < prec {
+			break
+		}
+		p.pos++
+		y, err := p.parse(binary[op.s] + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op.s, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) unary() (expr, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case 'n', 's':
+		return &litExpr{v: tok.v}, nil
+	case 'i':
+		switch tok.s {
+		case "true":
+			return &litExpr{v: true}, nil
+		case "false":
+			return &litExpr{v: false}, nil
+		case "null":
+			return &litExpr{v: nil}, nil
+		}
+		return &identExpr{name: tok.s}, nil
+	}
+	switch tok.s {
+	case "-", "!":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: tok.s, x: x}, nil
+	case "(":
+		x, err := p.parse(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].s != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", tok.s)
+}
+
+func (e *litExpr) eval(d *Decoder, ctx *Context) (interface{}, error) {
+	return e.v, nil
+}
+
+func (e *identExpr) eval(d *Decoder, ctx *Context) (interface{}, error) {
+	return d.get(ctx, strings.Split(e.name, ".")...).RawData().Raw(), nil
+}
+
+func (e *unaryExpr) eval(d *Decoder, ctx *Context) (interface{}, error) {
+	v, err := e.x.eval(d, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "!" {
+		return !truthy(v), nil
+	}
+	f, ok := num(v)
+	if !ok {
+		return nil, fmt.Errorf("-%+v: not a number", v)
+	}
+	return -f, nil
+}
+
+func (e *binaryExpr) eval(d *Decoder, ctx *Context) (interface{}, error) {
+	x, err := e.x.eval(d, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&":
+		if !truthy(x) {
+			return false, nil
+		}
+	case "||":
+		if truthy(x) {
+			return true, nil
+		}
+	}
+	y, err := e.y.eval(d, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&", "||":
+		return truthy(y), nil
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	}
+
+	fx, xok := num(x)
+	fy, yok := num(y)
+	sx, sxok := x.(string)
+	sy, syok := y.(string)
+	if !(xok && yok) && !(sxok && syok && (e.op == "+" || binary[e.op] == 4)) {
+		return nil, fmt.Errorf("%+v %s %+v: mismatched types", x, e.op, y)
+	}
+	switch e.op {
+	case "+":
+		if sxok {
+			return sx + sy, nil
+		}
+		return fx + fy, nil
+	case "-":
+		return fx - fy, nil
+	case "*":
+		return fx * fy, nil
+	case "/", "%":
+		if fy == 0 {
+			return nil, fmt.Errorf("%+v %s 0: division by zero", x, e.op)
+		}
+		if e.op == "%" {
+			return math.Mod(fx, fy), nil
+		}
+		return fx / fy, nil
+	}
+	cmp := 0
+	if sxok {
+		cmp = strings.Compare(sx, sy)
+	} else if fx < fy {
+		cmp = -1
+	} else if fx > fy {
+		cmp = 1
+	}
+	switch e.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+// num 数字转为float64, 字符串等其他类型不转换
+func num(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, true
+	case int:
+		return float64(vv), true
+	case int64:
+		return float64(vv), true
+	}
+	return 0, false
+}
+
+func equal(x, y interface{}) bool {
+	fx, xok := num(x)
+	fy, yok := num(y)
+	if xok && yok {
+		return fx == fy
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// splitExpr 拆分 {expr | fn...}, 忽略引号, 括号内和 || 中的 |
+func splitExpr(s string) []string {
+	ret := make([]string, 0, 2)
+	depth, start := 0, 0
+	var quot rune
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		switch {
+		case quot != 0:
+			if rs[i] == '\\' {
+				i++
+			} else if rs[i] == quot {
+				quot = 0
+			}
+		case rs[i] == sglquot || rs[i] == dblquot:
+			quot = rs[i]
+		case rs[i] == lparen:
+			depth++
+		case rs[i] == rparen:
+			depth--
+		case rs[i] == pipe && depth == 0:
+			if i+1 < len(rs) && rs[i+1] == pipe {
+				i++
+				continue
+			}
+			ret = append(ret, string(rs[start:i]))
+			start = i + 1
+		}
+	}
+	return append(ret, string(rs[start:]))
+}
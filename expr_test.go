@@ -0,0 +1,62 @@
+package jdecode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeExpr(t *testing.T) {
+	prebs := []byte(`{"page":2,"total":100,"used":37,"price":9.99,"name":"rob","quota":{"max":10,"used":10},"items":[{"sku":"a","price":5,"stock":1},{"sku":"b","price":20,"stock":0},{"sku":"c","price":30,"stock":3},{"sku":"d","price":15,"stock":2}]}`)
+	tcases := []testcase{
+		{
+			raw: `{"page":"@{page + 1}","left":"@{total - used}","cost":"@{price * 1.1 | round(2)}"}`,
+			des: []string{`{"page":3,"left":63,"cost":10.99}`},
+		},
+		{
+			raw: `{"pages":"@{(total + 9) / 10 | floor}","rest":"@{total % 30}","neg":"@{-used}","hi":"@{'hi ' + name}"}`,
+			des: []string{`{"pages":10,"rest":10,"neg":-37,"hi":"hi rob"}`},
+		},
+		{
+			raw: `{"full":"@{quota.used >= quota.max}","ok":"@{!(page == 2) || name != 'rob'}","cmp":"@{name < 'sam' && total > used}"}`,
+			des: []string{`{"full":true,"ok":false,"cmp":true}`},
+		},
+		{
+			raw: `{"exp":"@{total * 2e-2}","big":"@{1.5E+1 + 1e1}"}`,
+			des: []string{`{"exp":2,"big":25}`},
+		},
+		{
+			raw: `{"id":"@{page * 10}-p"}`,
+			des: []string{`{"id":"20-p"}`},
+		},
+		{
+			raw: `{"bad":"@{name * 2}","zero":"@{total / 0}","none":"@{missing + 1}"}`,
+			des: []string{`{"bad":"@{name * 2}","zero":"@{total / 0}","none":"@{missing + 1}"}`},
+		},
+		{
+			raw: `{"more":{"$if":"@{total - used > 50}","$then":"@{page + 1}"},"stop":{"$if":"quota.used < quota.max","$then":true}}`,
+			des: []string{`{"more":3}`},
+		},
+		{
+			raw: `{"sku":"@items,$range?limit=2&where=price * 2 > 20 && stock > 0","i":"@$index"}`,
+			des: []string{`{"sku":{"price":30,"sku":"c","stock":3},"i":0}`, `{"sku":{"price":15,"sku":"d","stock":2},"i":1}`},
+		},
+		{
+			raw: `{"sku":"@items,$range?where=sku == 'b' || price < 10,sku"}`,
+			des: []string{`{"sku":"a"}`, `{"sku":"b"}`},
+		},
+	}
+	for _, tc := range tcases {
+		des, _ := Decode(tc.raw, prebs)
+		if !reflect.DeepEqual(des, tc.des) {
+			t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	for _, it := range []string{"a +", "(a + 1", "a = 1", "'abc", "1 2"} {
+		if _, err := parseExpr(it); err == nil {
+			t.Errorf("parseExpr: %s, want err", it)
+		}
+	}
+}
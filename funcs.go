@@ -0,0 +1,486 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	pipe    = rune("|"[0])
+	lparen  = rune("("[0])
+	rparen  = rune(")"[0])
+	sglquot = rune("'"[0])
+)
+
+// Func 占位符中的函数: @vals|sum, @vals|sort|first, @name|pad(10,'0')
+// in 为管道前一步的值, args 为已求值的参数
+type Func func(in interface{}, args []interface{}) (interface{}, error)
+
+// gen 生成函数, 不需要输入: @$now, @$now|format_time('date'), @$rand_int(1,100)
+// ctx 为模板引用的文档, 如 @$script 以默认文档为响应
+type gen func(d *Decoder, ctx *Context, args []interface{}) (interface{}, error)
+
+var gens = map[string]gen{}
+
+var funcs = map[string]Func{
+	"len":     fnLen,
+	"sum":     fnSum,
+	"min":     fnMin,
+	"max":     fnMax,
+	"avg":     fnAvg,
+	"first":   fnFirst,
+	"last":    fnLast,
+	"unique":  fnUnique,
+	"flatten": fnFlatten,
+	"sort":    fnSort,
+}
+
+// call 一次函数调用, args 尚未求值
+type call struct {
+	name string
+	args []string
+}
+
+// pipeline 占位符中的函数管道: 以路径, 生成函数或表达式开头, 依次调用 calls
+type pipeline struct {
+	path  string
+	gen   *call
+	expr  expr
+	calls []call
+}
+
+// scanPipes 从 rs[i] 处的 | 开始扫描函数管道, 返回管道结束的位置
+func scanPipes(rs []rune, i int) int {
+	size := len(rs)
+	end := i
+	for i < size && rs[i] == pipe {
+		j := i + 1
+		for j < size && (unicode.IsLetter(rs[j]) || unicode.IsNumber(rs[j]) || rs[j] == '_') {
+			j++
+		}
+		if j == i+1 {
+			return end
+		}
+		if j < size && rs[j] == lparen {
+			k := closeParen(rs, j)
+			if k < 0 {
+				return end
+			}
+			j = k + 1
+		}
+		end, i = j, j
+	}
+	return end
+}
+
+// closeParen 返回与 rs[i] 处的 ( 匹配的 ) 的位置, 引号内的括号不计
+func closeParen(rs []rune, i int) int {
+	return closeDelim(rs, i, lparen, rparen)
+}
+
+// closeDelim 返回与 rs[i] 处的 open 匹配的 close 的位置
+func closeDelim(rs []rune, i int, open, close rune) int {
+	depth := 0
+	var quot rune
+	for ; i < len(rs); i++ {
+		switch {
+		case quot != 0:
+			if rs[i] == '\\' {
+				i++
+			} else if rs[i] == quot {
+				quot = 0
+			}
+		case rs[i] == sglquot || rs[i] == dblquot:
+			quot = rs[i]
+		case rs[i] == open:
+			depth++
+		case rs[i] == close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parsePipeline 拆分路径和函数管道: vals,0|sort|first ==> vals,0 [sort first]
+// 以$开头的生成函数没有路径: $now|to_unix ==> $now [to_unix]
+// {}中为表达式, 管道写在{}内: {price * 1.1 | round(2)}
+func parsePipeline(it string) (*pipeline, bool) {
+	if strings.HasPrefix(it, "{") && strings.HasSuffix(it, "}") {
+		parts := splitExpr(it[1 : len(it)-1])
+		x, err := parseExpr(parts[0])
+		if err != nil {
+			log.Errorf("%s, err:%+v", it, err)
+			return nil, false
+		}
+		p := &pipeline{expr: x, calls: make([]call, 0, len(parts)-1)}
+		for _, c := range parts[1:] {
+			p.calls = append(p.calls, parseCall(c))
+		}
+		return p, true
+	}
+	if directiveQuery(it) {
+		// 指令参数中的 | 不是管道: $range?where=a || b
+		return nil, false
+	}
+	parts := splitTop(it, pipe)
+	p := &pipeline{path: parts[0]}
+	if strings.HasPrefix(p.path, "$") {
+		if c := parseCall(p.path[1:]); gens[c.name] != nil {
+			p.path, p.gen = "", &c
+		}
+	}
+	if len(parts) <= 1 && p.gen == nil {
+		return nil, false
+	}
+	p.calls = make([]call, 0, len(parts)-1)
+	for _, c := range parts[1:] {
+		p.calls = append(p.calls, parseCall(c))
+	}
+	return p, true
+}
+
+// directiveQuery 路径中是否有指令参数: items,$range?limit=10
+func directiveQuery(it string) bool {
+	for _, seg := range strings.Split(it, ",") {
+		if !strings.HasPrefix(seg, "$") {
+			continue
+		}
+		q, p := strings.IndexRune(seg, query), strings.IndexRune(seg, lparen)
+		if q > 0 && (p < 0 || q < p) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCall 解析函数调用: pad(10,'0') ==> pad [10 '0']
+func parseCall(c string) call {
+	c = strings.TrimSpace(c)
+	name, args := c, ""
+	if p := strings.IndexRune(c, lparen); p > 0 && strings.HasSuffix(c, ")") {
+		name, args = c[:p], c[p+1:len(c)-1]
+	}
+	cl := call{name: name}
+	if strings.TrimSpace(args) != "" {
+		cl.args = splitTop(args, comma)
+	}
+	return cl
+}
+
+// splitTop 按 sep 拆分字符串, 忽略引号和括号内的 sep
+func splitTop(s string, sep rune) []string {
+	ret := make([]string, 0, 2)
+	depth, start := 0, 0
+	var quot rune
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		switch {
+		case quot != 0:
+			if rs[i] == '\\' {
+				i++
+			} else if rs[i] == quot {
+				quot = 0
+			}
+		case rs[i] == sglquot || rs[i] == dblquot:
+			quot = rs[i]
+		case rs[i] == lparen:
+			depth++
+		case rs[i] == rparen:
+			depth--
+		case rs[i] == sep && depth == 0:
+			ret = append(ret, string(rs[start:i]))
+			start = i + 1
+		}
+	}
+	return append(ret, string(rs[start:]))
+}
+
+// evalArg 参数求值: 'str', "str", 数字, true/false/null, 以@开头的路径(用.分隔), 其余按字符串处理
+func (d *Decoder) evalArg(ctx *Context, arg string) interface{} {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		return strings.Replace(arg[1:len(arg)-1], `\'`, `'`, -1)
+	}
+	if len(arg) >= 2 && arg[0] == '"' {
+		if s, err := strconv.Unquote(arg); err == nil {
+			return s
+		}
+	}
+	if len(arg) > 0 && arg[0] == at {
+		return d.get(ctx, strings.Split(arg[1:], ".")...).RawData().Raw()
+	}
+	switch arg {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if f, err := strconv.ParseFloat(arg, 64); err == nil {
+		return f
+	}
+	return arg
+}
+
+func (d *Decoder) evalArgs(ctx *Context, c call) []interface{} {
+	args := make([]interface{}, len(c.args))
+	for i, a := range c.args {
+		args[i] = d.evalArg(ctx, a)
+	}
+	return args
+}
+
+// eval 求值管道: 取路径的值或调用生成函数, 再依次调用管道中的函数
+func (p *pipeline) eval(d *Decoder, ctx *Context) (interface{}, error) {
+	var in interface{}
+	if p.expr != nil {
+		v, err := p.expr.eval(d, ctx)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		in = v
+	} else if p.gen != nil {
+		v, err := gens[p.gen.name](d, ctx, d.evalArgs(ctx, *p.gen))
+		if err != nil {
+			return nil, fmt.Errorf("$%s: %+v", p.gen.name, err)
+		}
+		in = v
+	} else {
+		in = d.get(ctx, TrimPath(strings.Split(p.path, ",")).prefixPaths...).RawData().Raw()
+		if in == nil {
+			return nil, nil
+		}
+	}
+	return p.apply(d, ctx, in)
+}
+
+// apply 以 in 为输入依次调用管道中的函数
+func (p *pipeline) apply(d *Decoder, ctx *Context, in interface{}) (interface{}, error) {
+	for _, c := range p.calls {
+		f, ok := lookupFunc(c.name)
+		if !ok {
+			return nil, fmt.Errorf("func %s not found", c.name)
+		}
+		var err error
+		if in, err = f(in, d.evalArgs(ctx, c)); err != nil {
+			return nil, fmt.Errorf("%s: %+v", c.name, err)
+		}
+	}
+	return in, nil
+}
+
+// quote 按模板中的写法转义字符串
+func quote(s string) string {
+	buf := &strings.Builder{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, nil
+	case int:
+		return float64(vv), nil
+	case int64:
+		return float64(vv), nil
+	case string:
+		return strconv.ParseFloat(vv, 64)
+	case bool:
+		if vv {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%+v is not a number", v)
+}
+
+func toSlice(v interface{}) ([]interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%+v is not an array", v)
+	}
+	return arr, nil
+}
+
+func toFloats(v interface{}) ([]float64, error) {
+	arr, err := toSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float64, len(arr))
+	for i, it := range arr {
+		if ret[i], err = toFloat(it); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func fnLen(in interface{}, args []interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case []interface{}:
+		return len(v), nil
+	case map[string]interface{}:
+		return len(v), nil
+	case string:
+		return len([]rune(v)), nil
+	}
+	return nil, fmt.Errorf("%+v has no length", in)
+}
+
+func fnSum(in interface{}, args []interface{}) (interface{}, error) {
+	fs, err := toFloats(in)
+	if err != nil {
+		return nil, err
+	}
+	var sum float64
+	for _, f := range fs {
+		sum += f
+	}
+	return sum, nil
+}
+
+func fnMin(in interface{}, args []interface{}) (interface{}, error) {
+	fs, err := toFloats(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) <= 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	min := fs[0]
+	for _, f := range fs[1:] {
+		if f < min {
+			min = f
+		}
+	}
+	return min, nil
+}
+
+func fnMax(in interface{}, args []interface{}) (interface{}, error) {
+	fs, err := toFloats(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) <= 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	max := fs[0]
+	for _, f := range fs[1:] {
+		if f > max {
+			max = f
+		}
+	}
+	return max, nil
+}
+
+func fnAvg(in interface{}, args []interface{}) (interface{}, error) {
+	fs, err := toFloats(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) <= 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	sum, _ := fnSum(in, nil)
+	return sum.(float64) / float64(len(fs)), nil
+}
+
+func fnFirst(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) <= 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	return arr[0], nil
+}
+
+func fnLast(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) <= 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	return arr[len(arr)-1], nil
+}
+
+// fnUnique 去重, 保留第一次出现的顺序
+func fnUnique(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(arr))
+	ret := make([]interface{}, 0, len(arr))
+	for _, it := range arr {
+		bs, _ := jsonen(it)
+		if seen[string(bs)] {
+			continue
+		}
+		seen[string(bs)] = true
+		ret = append(ret, it)
+	}
+	return ret, nil
+}
+
+// fnFlatten 展开一层嵌套数组
+func fnFlatten(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, 0, len(arr))
+	for _, it := range arr {
+		if sub, ok := it.([]interface{}); ok {
+			ret = append(ret, sub...)
+		} else {
+			ret = append(ret, it)
+		}
+	}
+	return ret, nil
+}
+
+// fnSort 升序排序, 数字按大小, 其余按字符串; sort('name') 按对象的name字段排序
+func fnSort(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if len(args) > 0 {
+		key = fmt.Sprint(args[0])
+	}
+	sortVal := func(v interface{}) interface{} {
+		if m, ok := v.(map[string]interface{}); ok && key != "" {
+			return m[key]
+		}
+		return v
+	}
+	ret := make([]interface{}, len(arr))
+	copy(ret, arr)
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := sortVal(ret[i]), sortVal(ret[j])
+		fa, aok := a.(float64)
+		fb, bok := b.(float64)
+		if aok && bok {
+			return fa < fb
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return ret, nil
+}
@@ -0,0 +1,110 @@
+package jdecode
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/toukii/jsnm"
+)
+
+// body 已渲染的请求体: @$body|hmac_sha256('key')|hex, @$body('data,ts')|sha256|hex
+const body = "body"
+
+func init() {
+	gens[body] = genBody
+	funcs["sha256"] = fnSha256
+	funcs["md5"] = fnMd5
+	funcs["hmac_sha256"] = fnHmacSha256
+	funcs["base64"] = fnBase64
+	funcs["hex"] = fnHex
+}
+
+func toBytes(v interface{}) []byte {
+	if bs, ok := v.([]byte); ok {
+		return bs
+	}
+	return []byte(toStr(v))
+}
+
+// genBody 只在渲染完成后由sign求值
+func genBody(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("$body is only available in templates")
+}
+
+// sign 求值请求体签名. 签名的内容为规范形式: post_render之后的请求体中, 所有@$body占位符替换为空字符串"",
+// 其余的字节不变, 成员的顺序和空白同模板, 如 {"ts":"1700000000","sig":""};
+// 校验方把收到的请求体中签名字段的值置为""后, 对原样的字节计算签名.
+// @$body('data,ts') 为规范形式中路径对应的值, 字符串原样使用, 其余为紧凑的json
+func (d *Decoder) sign(ctx *Context, raw string, signs []string) string {
+	blank := &subst{}
+	for _, it := range signs {
+		blank.set(it, "", -1)
+	}
+	rendered := blank.apply(raw)
+	var doc *jsnm.Jsnm
+	vals := &subst{}
+	for _, it := range signs {
+		p, _ := parsePipeline(it)
+		var in interface{} = rendered
+		if len(p.gen.args) > 0 {
+			if doc == nil {
+				doc = jsnm.BytesFmt([]byte(rendered))
+			}
+			path := toStr(d.evalArg(ctx, p.gen.args[0]))
+			val := doc.ArrGet(strings.Split(path, ",")...).RawData().Raw()
+			if val == nil {
+				log.Errorf("%s: %s not found in body", it, path)
+				continue
+			}
+			if _, ok := val.(string); !ok {
+				bs, _ := jsonen(val)
+				val = string(bs)
+			}
+			in = val
+		}
+		val, err := p.apply(d, ctx, in)
+		if err != nil {
+			log.Errorf("%s, err:%+v", it, err)
+			continue
+		}
+		vals.set(it, val, -1)
+	}
+	return vals.apply(raw)
+}
+
+func fnSha256(in interface{}, args []interface{}) (interface{}, error) {
+	sum := sha256.Sum256(toBytes(in))
+	return sum[:], nil
+}
+
+func fnMd5(in interface{}, args []interface{}) (interface{}, error) {
+	sum := md5.Sum(toBytes(in))
+	return sum[:], nil
+}
+
+// fnHmacSha256 hmac_sha256('key')
+func fnHmacSha256(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("hmac_sha256(key) needs a key")
+	}
+	mac := hmac.New(sha256.New, toBytes(args[0]))
+	mac.Write(toBytes(in))
+	return mac.Sum(nil), nil
+}
+
+// fnBase64 base64, base64('url') 使用url安全的编码
+func fnBase64(in interface{}, args []interface{}) (interface{}, error) {
+	if toStr(arg(args, 0, "std")) == "url" {
+		return base64.RawURLEncoding.EncodeToString(toBytes(in)), nil
+	}
+	return base64.StdEncoding.EncodeToString(toBytes(in)), nil
+}
+
+func fnHex(in interface{}, args []interface{}) (interface{}, error) {
+	return hex.EncodeToString(toBytes(in)), nil
+}
@@ -0,0 +1,81 @@
+package jdecode
+
+import (
+	"fmt"
+	"math"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func init() {
+	gens["uuid"] = genUUID
+	gens["rand_int"] = genRandInt
+	gens["rand_string"] = genRandString
+	gens["seq"] = genSeq
+}
+
+// genUUID 使用Decoder的随机数生成uuid v4
+func genUUID(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	var u [16]byte
+	for i := range u {
+		u[i] = byte(d.Intn(256))
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// genRandInt rand_int(min, max), 包含min和max; 超出int64的参数取int64的边界
+func genRandInt(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	min, err := toInt64(arg(args, 0, 0.0))
+	if err != nil {
+		return nil, err
+	}
+	max, err := toInt64(arg(args, 1, float64(1<<31-1)))
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("rand_int(%d, %d): max < min", min, max)
+	}
+	return d.between(min, max), nil
+}
+
+// toInt64 转为int64, 超出范围时取边界
+func toInt64(v interface{}) (int64, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case math.IsNaN(f):
+		return 0, fmt.Errorf("%+v is not a number", v)
+	case f >= math.MaxInt64:
+		return math.MaxInt64, nil
+	case f <= math.MinInt64:
+		return math.MinInt64, nil
+	}
+	return int64(f), nil
+}
+
+// genRandString rand_string(16), rand_string(6, '0123456789')
+func genRandString(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	n, err := toInt(arg(args, 0, 16.0))
+	if err != nil {
+		return nil, err
+	}
+	chars := []rune(toStr(arg(args, 1, letters)))
+	if len(chars) <= 0 || n < 0 {
+		return nil, fmt.Errorf("rand_string(%d, %s)", n, string(chars))
+	}
+	rs := make([]rune, n)
+	for i := range rs {
+		rs[i] = chars[d.Intn(len(chars))]
+	}
+	return string(rs), nil
+}
+
+// genSeq seq('order'), 每个名字各自从1开始递增
+func genSeq(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	return d.Next(toStr(arg(args, 0, ""))), nil
+}
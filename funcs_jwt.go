@@ -0,0 +1,114 @@
+package jdecode
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+func init() {
+	gens["jwt"] = genJwt
+	funcs["jwt"] = fnJwt
+}
+
+// genJwt $jwt(claims, key, alg), claims为json字符串或@开头的路径:
+// @$jwt('{"sub":"u1"}', 'secret'), @$jwt(@user.claims, '@rsa.pem', 'RS256')
+func genJwt(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("jwt(claims, key, alg) needs claims and key")
+	}
+	return fnJwt(args[0], args[1:])
+}
+
+// fnJwt jwt(key, alg), 以输入为claims签发token; alg支持HS256(默认), RS256;
+// key以@开头时为密钥文件, RS256的密钥为PEM格式的PKCS1或PKCS8私钥
+func fnJwt(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("jwt(key, alg) needs a key")
+	}
+	claims := in
+	if str, ok := in.(string); ok {
+		if err := json.Unmarshal([]byte(str), &claims); err != nil {
+			return nil, fmt.Errorf("claims %s: %+v", str, err)
+		}
+	}
+	if _, ok := claims.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("claims %+v is not an object", in)
+	}
+	key, err := jwtKey(toStr(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	alg := strings.ToUpper(toStr(arg(args, 1, "HS256")))
+
+	header, _ := jsonen(iv{"alg": alg, "typ": "JWT"})
+	payload, err := jsonen(claims)
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+
+	var sig []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signing))
+		sig = mac.Sum(nil)
+	case "RS256":
+		pk, err := rsaKey(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(signing))
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, sum[:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %s", alg)
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+// jwtKey @开头时读取密钥文件
+func jwtKey(key string) ([]byte, error) {
+	if !strings.HasPrefix(key, "@") {
+		return []byte(key), nil
+	}
+	bs, err := ioutil.ReadFile(key[1:])
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(bs), "-----BEGIN") {
+		bs = []byte(strings.TrimSpace(string(bs)))
+	}
+	return bs, nil
+}
+
+func rsaKey(bs []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in RS256 key")
+	}
+	if pk, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return pk, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("RS256 key is not an RSA private key")
+	}
+	return pk, nil
+}
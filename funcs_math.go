@@ -0,0 +1,50 @@
+package jdecode
+
+import (
+	"math"
+)
+
+func init() {
+	funcs["round"] = fnRound
+	funcs["floor"] = fnFloor
+	funcs["ceil"] = fnCeil
+	funcs["abs"] = fnAbs
+}
+
+// fnRound round(n), 保留n位小数, 默认取整
+func fnRound(in interface{}, args []interface{}) (interface{}, error) {
+	f, err := toFloat(in)
+	if err != nil {
+		return nil, err
+	}
+	n, err := toInt(arg(args, 0, 0.0))
+	if err != nil {
+		return nil, err
+	}
+	pow := math.Pow(10, float64(n))
+	return math.Round(f*pow) / pow, nil
+}
+
+func fnFloor(in interface{}, args []interface{}) (interface{}, error) {
+	f, err := toFloat(in)
+	if err != nil {
+		return nil, err
+	}
+	return math.Floor(f), nil
+}
+
+func fnCeil(in interface{}, args []interface{}) (interface{}, error) {
+	f, err := toFloat(in)
+	if err != nil {
+		return nil, err
+	}
+	return math.Ceil(f), nil
+}
+
+func fnAbs(in interface{}, args []interface{}) (interface{}, error) {
+	f, err := toFloat(in)
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(f), nil
+}
@@ -0,0 +1,180 @@
+package jdecode
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	funcs["upper"] = fnUpper
+	funcs["lower"] = fnLower
+	funcs["trim"] = fnTrim
+	funcs["substr"] = fnSubstr
+	funcs["replace"] = fnReplace
+	funcs["split"] = fnSplit
+	funcs["join"] = fnJoin
+	funcs["concat"] = fnConcat
+	funcs["pad"] = fnPad
+	funcs["regex_extract"] = fnRegexExtract
+}
+
+// toStr 字符串原样返回, 数字不带多余的0, 其余转为json
+func toStr(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case []byte:
+		return string(vv)
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	bs, err := jsonen(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bs)
+}
+
+func toInt(v interface{}) (int, error) {
+	f, err := toFloat(v)
+	return int(f), err
+}
+
+// arg 返回第i个参数, 不存在时返回def
+func arg(args []interface{}, i int, def interface{}) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return def
+}
+
+func fnUpper(in interface{}, args []interface{}) (interface{}, error) {
+	return strings.ToUpper(toStr(in)), nil
+}
+
+func fnLower(in interface{}, args []interface{}) (interface{}, error) {
+	return strings.ToLower(toStr(in)), nil
+}
+
+// fnTrim 去掉首尾空白, trim('-') 去掉首尾的指定字符
+func fnTrim(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) > 0 {
+		return strings.Trim(toStr(in), toStr(args[0])), nil
+	}
+	return strings.TrimSpace(toStr(in)), nil
+}
+
+// fnSubstr substr(start, length), start为负数时从末尾开始计算, 按字符计数
+func fnSubstr(in interface{}, args []interface{}) (interface{}, error) {
+	rs := []rune(toStr(in))
+	size := len(rs)
+	start, err := toInt(arg(args, 0, 0.0))
+	if err != nil {
+		return nil, err
+	}
+	length, err := toInt(arg(args, 1, float64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > size {
+		start = size
+	}
+	end := start + length
+	if length < 0 || end > size {
+		end = size
+	}
+	return string(rs[start:end]), nil
+}
+
+func fnReplace(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("replace(old, new) needs 2 args")
+	}
+	return strings.Replace(toStr(in), toStr(args[0]), toStr(args[1]), -1), nil
+}
+
+func fnSplit(in interface{}, args []interface{}) (interface{}, error) {
+	parts := strings.Split(toStr(in), toStr(arg(args, 0, ",")))
+	ret := make([]interface{}, len(parts))
+	for i, it := range parts {
+		ret[i] = it
+	}
+	return ret, nil
+}
+
+func fnJoin(in interface{}, args []interface{}) (interface{}, error) {
+	arr, err := toSlice(in)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(arr))
+	for i, it := range arr {
+		parts[i] = toStr(it)
+	}
+	return strings.Join(parts, toStr(arg(args, 0, ","))), nil
+}
+
+// fnConcat 依次拼接参数, 参数可以是@开头的路径: @first|concat(' ', @last)
+func fnConcat(in interface{}, args []interface{}) (interface{}, error) {
+	buf := &strings.Builder{}
+	buf.WriteString(toStr(in))
+	for _, it := range args {
+		buf.WriteString(toStr(it))
+	}
+	return buf.String(), nil
+}
+
+// fnPad pad(width, char, side), 默认用空格左补齐; side为right时右补齐
+func fnPad(in interface{}, args []interface{}) (interface{}, error) {
+	str := toStr(in)
+	width, err := toInt(arg(args, 0, 0.0))
+	if err != nil {
+		return nil, err
+	}
+	char := toStr(arg(args, 1, " "))
+	if char == "" {
+		return nil, fmt.Errorf("empty pad char")
+	}
+	n := width - len([]rune(str))
+	if n <= 0 {
+		return str, nil
+	}
+	padding := []rune(strings.Repeat(char, n))[:n]
+	if toStr(arg(args, 2, "left")) == "right" {
+		return str + string(padding), nil
+	}
+	return string(padding) + str, nil
+}
+
+// fnRegexExtract regex_extract(pattern, group), 返回第一个匹配的分组, 默认为整个匹配
+func fnRegexExtract(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("regex_extract(pattern) needs a pattern")
+	}
+	re, err := regexp.Compile(toStr(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	group, err := toInt(arg(args, 1, 0.0))
+	if err != nil {
+		return nil, err
+	}
+	m := re.FindStringSubmatch(toStr(in))
+	if m == nil {
+		return nil, fmt.Errorf("%s not match %s", toStr(in), re)
+	}
+	if group < 0 || group >= len(m) {
+		return nil, fmt.Errorf("group %d out of range", group)
+	}
+	return m[group], nil
+}
@@ -0,0 +1,200 @@
+package jdecode
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toukii/jsnm"
+)
+
+// maxStepTimes $step展开的时间的最大个数
+const maxStepTimes = 100000
+
+var (
+	layouts = map[string]string{
+		"rfc3339":     time.RFC3339,
+		"rfc3339nano": time.RFC3339Nano,
+		"date":        "2006-01-02",
+		"datetime":    "2006-01-02 15:04:05",
+		"rfc1123":     time.RFC1123,
+	}
+)
+
+func init() {
+	gens["now"] = genNow
+	gens["today"] = genToday
+	funcs["add_duration"] = fnAddDuration
+	funcs["format_time"] = fnFormatTime
+	funcs["parse_time"] = fnParseTime
+	funcs["to_unix"] = fnToUnix
+}
+
+// SetClock 设置@$now, @$today使用的时钟, 测试时可以固定时间; now为nil时使用time.Now
+func (d *Decoder) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	d.mu.Lock()
+	d.clock = now
+	d.mu.Unlock()
+}
+
+func SetClock(now func() time.Time) {
+	std.SetClock(now)
+}
+
+// now Decoder的时钟
+func (d *Decoder) now() time.Time {
+	d.mu.Lock()
+	clock := d.clock
+	d.mu.Unlock()
+	return clock()
+}
+
+// layout 支持 rfc3339, date 等名字, 其余按go的时间格式处理
+func layout(name string) string {
+	if l, ok := layouts[strings.ToLower(name)]; ok {
+		return l
+	}
+	return name
+}
+
+// parseDuration 在time.ParseDuration的基础上支持天: -7d
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// toTime 时间, rfc3339或date格式的字符串, unix秒(大于1e12时按毫秒)
+func toTime(v interface{}) (time.Time, error) {
+	switch vv := v.(type) {
+	case time.Time:
+		return vv, nil
+	case string:
+		for _, l := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if t, err := time.Parse(l, vv); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%s is not a time", vv)
+	case float64:
+		if vv > 1e12 {
+			return time.Unix(0, int64(vv)*int64(time.Millisecond)), nil
+		}
+		return time.Unix(int64(vv), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%+v is not a time", v)
+}
+
+func genNow(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	return d.now(), nil
+}
+
+// genToday 当天的零点
+func genToday(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	now := d.now()
+	y, m, day := now.Date()
+	return time.Date(y, m, day, 0, 0, 0, 0, now.Location()), nil
+}
+
+// fnAddDuration add_duration('-168h'), add_duration('-7d')
+func fnAddDuration(in interface{}, args []interface{}) (interface{}, error) {
+	t, err := toTime(in)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parseDuration(toStr(arg(args, 0, "0s")))
+	if err != nil {
+		return nil, err
+	}
+	return t.Add(d), nil
+}
+
+// fnFormatTime format_time('rfc3339'), format_time('2006/01/02'), 默认rfc3339
+func fnFormatTime(in interface{}, args []interface{}) (interface{}, error) {
+	t, err := toTime(in)
+	if err != nil {
+		return nil, err
+	}
+	return t.Format(layout(toStr(arg(args, 0, "rfc3339")))), nil
+}
+
+// fnParseTime parse_time('2006/01/02'), 不指定格式时同toTime
+func fnParseTime(in interface{}, args []interface{}) (interface{}, error) {
+	if len(args) <= 0 {
+		return toTime(in)
+	}
+	return time.Parse(layout(toStr(args[0])), toStr(in))
+}
+
+// fnToUnix to_unix, to_unix('ms'), to_unix('ns')
+func fnToUnix(in interface{}, args []interface{}) (interface{}, error) {
+	t, err := toTime(in)
+	if err != nil {
+		return nil, err
+	}
+	switch unit := toStr(arg(args, 0, "s")); unit {
+	case "s":
+		return t.Unix(), nil
+	case "ms":
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case "ns":
+		return t.UnixNano(), nil
+	default:
+		return nil, fmt.Errorf("unsupported unit %s", unit)
+	}
+}
+
+// stepTimes $step的起止为时间时, 按by(默认24h)步进, 按format(默认rfc3339)输出
+// @days,$step?by=12h&format=date; 结束早于开始或超过maxStepTimes个时出错
+func stepTimes(arr []*jsnm.Jsnm, params url.Values) ([]string, bool) {
+	if len(arr) < 2 {
+		return nil, false
+	}
+	if _, ok := arr[0].RawData().Raw().(string); !ok {
+		return nil, false
+	}
+	from, err := toTime(arr[0].RawData().Raw())
+	if err != nil {
+		return nil, false
+	}
+	to, err := toTime(arr[1].RawData().Raw())
+	if err != nil {
+		log.Errorf("$step: %+v", err)
+		return []string{}, true
+	}
+	by := 24 * time.Hour
+	if s := params.Get("by"); s != "" {
+		if by, err = parseDuration(s); err != nil || by <= 0 {
+			log.Errorf("$step by=%s, err:%+v", s, err)
+			return []string{}, true
+		}
+	}
+	l := layout("rfc3339")
+	if s := params.Get("format"); s != "" {
+		l = layout(s)
+	}
+	if to.Before(from) {
+		log.Errorf("$step: %s is before %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+		return []string{}, true
+	}
+	n := to.Sub(from) / by
+	if n >= maxStepTimes {
+		log.Errorf("$step by=%s: more than %d times", by, maxStepTimes)
+		return []string{}, true
+	}
+	ret := make([]string, 0, int(n)+1)
+	for t := from; t.Before(to); t = t.Add(by) {
+		ret = append(ret, quote(t.Format(l)))
+	}
+	return ret, true
+}
@@ -0,0 +1,191 @@
+package jdecode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Plugin wasm插件, 导出的函数注册为模板中的函数: @name|mask('*')
+//
+// 插件的ABI以json传递参数和返回值:
+//
+//	alloc(size i32) i32           分配size字节的内存, 返回地址
+//	dealloc(ptr i32, size i32)    可选, 释放alloc分配的内存
+//	name(ptr i32, len i32) i64    函数, 参数为 {"value":输入,"args":[参数...]},
+//	                              返回值为 (ptr<<32 | len), 内容为 {"value":结果} 或 {"error":"错误"}
+//
+// 插件可以用任何能编译到wasm的语言实现, 使用WASI的插件以reactor方式加载
+type Plugin struct {
+	mu      sync.Mutex
+	file    string
+	rt      wazero.Runtime
+	mod     api.Module
+	alloc   api.Function
+	dealloc api.Function
+	names   []string
+}
+
+var (
+	// pluginTimeout 模板中调用插件函数的超时, 超时后插件被关闭, 之后的调用都出错
+	pluginTimeout = 5 * time.Second
+	// pluginMemoryPages 插件内存的上限, 每页64KiB
+	pluginMemoryPages uint32 = 256
+)
+
+type pluginResult struct {
+	Value interface{} `json:"value"`
+	Error string      `json:"error"`
+}
+
+// LoadPlugin 加载wasm插件file, 注册其中签名为 (i32, i32) i64 的导出函数, 与已有的函数重名时出错
+func LoadPlugin(file string) (*Plugin, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	cfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(pluginMemoryPages)
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	p := &Plugin{file: file, rt: rt}
+	if err = p.load(ctx, bs); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %+v", file, err)
+	}
+	return p, nil
+}
+
+func (p *Plugin) load(ctx context.Context, bs []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.rt); err != nil {
+		return err
+	}
+	compiled, err := p.rt.CompileModule(ctx, bs)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, 4)
+	for name, def := range compiled.ExportedFunctions() {
+		params, results := def.ParamTypes(), def.ResultTypes()
+		if name == "dealloc" || len(params) != 2 || len(results) != 1 ||
+			params[0] != api.ValueTypeI32 || params[1] != api.ValueTypeI32 || results[0] != api.ValueTypeI64 {
+			continue
+		}
+		if _, ok := lookupFunc(name); ok {
+			return fmt.Errorf("func %s already exists", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg := wazero.NewModuleConfig().WithStartFunctions("_initialize")
+	if p.mod, err = p.rt.InstantiateModule(ctx, compiled, cfg); err != nil {
+		return err
+	}
+	if p.alloc = p.mod.ExportedFunction("alloc"); p.alloc == nil {
+		return fmt.Errorf("alloc not exported")
+	}
+	p.dealloc = p.mod.ExportedFunction("dealloc")
+	for _, name := range names {
+		name := name
+		err = RegisterFunc(name, func(in interface{}, args []interface{}) (interface{}, error) {
+			return p.Call(name, in, args)
+		})
+		if err != nil {
+			// 运行时随后被关闭, 注销已注册的函数
+			for _, it := range p.names {
+				unregisterFunc(it)
+			}
+			p.names = nil
+			return err
+		}
+		p.names = append(p.names, name)
+	}
+	return nil
+}
+
+// Names 返回插件注册的函数
+func (p *Plugin) Names() []string {
+	return p.names
+}
+
+// Call 调用插件中的函数name, 超时为pluginTimeout
+func (p *Plugin) Call(name string, in interface{}, args []interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	return p.CallContext(ctx, name, in, args)
+}
+
+// CallContext 调用插件中的函数name, ctx结束时中止执行并关闭插件
+func (p *Plugin) CallContext(ctx context.Context, name string, in interface{}, args []interface{}) (interface{}, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	bs, err := jsonen(iv{"value": in, "args": args})
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn := p.mod.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("plugin %s: %s not exported", p.file, name)
+	}
+
+	rets, err := p.alloc.Call(ctx, uint64(len(bs)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(rets[0])
+	if !p.mod.Memory().Write(ptr, bs) {
+		return nil, fmt.Errorf("plugin %s: write %d bytes at %d out of range", p.file, len(bs), ptr)
+	}
+	defer p.free(ctx, ptr, uint32(len(bs)))
+
+	if rets, err = fn.Call(ctx, uint64(ptr), uint64(len(bs))); err != nil {
+		return nil, err
+	}
+	rptr, rsize := uint32(rets[0]>>32), uint32(rets[0])
+	out, ok := p.mod.Memory().Read(rptr, rsize)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: read %d bytes at %d out of range", p.file, rsize, rptr)
+	}
+	var ret pluginResult
+	err = json.Unmarshal(out, &ret)
+	p.free(ctx, rptr, rsize)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %s returns %s, err:%+v", p.file, name, out, err)
+	}
+	if ret.Error != "" {
+		return nil, fmt.Errorf("%s", ret.Error)
+	}
+	return ret.Value, nil
+}
+
+// free 插件导出了dealloc时释放内存
+func (p *Plugin) free(ctx context.Context, ptr, size uint32) {
+	if p.dealloc == nil {
+		return
+	}
+	if _, err := p.dealloc.Call(ctx, uint64(ptr), uint64(size)); err != nil {
+		log.Errorf("plugin %s: dealloc, err:%+v", p.file, err)
+	}
+}
+
+// Close 注销插件的函数并释放运行时
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range p.names {
+		unregisterFunc(name)
+	}
+	p.names = nil
+	return p.rt.Close(context.Background())
+}
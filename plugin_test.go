@@ -0,0 +1,67 @@
+package jdecode
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// echoWasm 导出 alloc 和 echo 的插件, echo 原样返回参数, 即返回输入的值:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (global $heap (mut i32) (i32.const 1024))
+//	  (func (export "alloc") (param i32) (result i32)
+//	    global.get $heap  global.get $heap  local.get 0  i32.add  global.set $heap)
+//	  (func (export "echo") (param i32 i32) (result i64)
+//	    local.get 0  i64.extend_i32_u  i64.const 32  i64.shl  local.get 1  i64.extend_i32_u  i64.or))
+const echoWasm = "0061736d01000000010c0260017f017f60027f7f017e030302000105030100010607017f014180080b" +
+	"071903066d656d6f7279020005616c6c6f630000046563686f00010a1a020b002300230020006a24000b" +
+	"0c002000ad4220862001ad840b"
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bs, _ := hex.DecodeString(echoWasm)
+	file := filepath.Join(dir, "echo.wasm")
+	if err = ioutil.WriteFile(file, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPlugin(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := p.Names(); !reflect.DeepEqual(names, []string{"echo"}) {
+		t.Errorf("Names ==> [echo], but: %+v", names)
+	}
+	if _, err = LoadPlugin(file); err == nil {
+		t.Errorf("LoadPlugin twice, want err")
+	}
+
+	raw := `{"user":"@user|echo('x', 1)","n":"@ids|echo|sum"}`
+	des, _ := Decode(raw, []byte(`{"user":{"name":"rob"},"ids":[1,2,3]}`))
+	if want := []string{`{"user":{"name":"rob"},"n":6}`}; !reflect.DeepEqual(des, want) {
+		t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = p.CallContext(cctx, "echo", "x", nil); err == nil {
+		t.Errorf("CallContext with done ctx, want err")
+	}
+
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupFunc("echo"); ok {
+		t.Errorf("echo should be removed after Close")
+	}
+}
@@ -0,0 +1,99 @@
+package jdecode
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/toukii/jsnm"
+)
+
+// Directive 自定义指令, 把一个模板展开为多个: @path,$name?k=v,suffix
+// val 为指令前的路径的值, suffix 为指令后的路径, params 为指令参数;
+// 返回每个输出中占位符的值, 输出中可以使用@$index, @$count, @$first, @$last
+type Directive func(val interface{}, suffix []string, params url.Values) ([]interface{}, error)
+
+var (
+	registryMu sync.RWMutex
+
+	// builtins 内置指令, 设置RangePath对应的标记
+	builtins = map[string]func(r *RangePath){
+		ranger:  func(r *RangePath) { r.ranged = true },
+		step:    func(r *RangePath) { r.step = true },
+		slice:   func(r *RangePath) { r.slice = true },
+		this:    func(r *RangePath) { r.this = true },
+		entries: func(r *RangePath) { r.entries = true },
+		keys:    func(r *RangePath) { r.keys = true },
+		values:  func(r *RangePath) { r.values = true },
+	}
+
+	directives = map[string]Directive{}
+)
+
+// RegisterFunc 注册函数name, 模板中以 @path|name(args) 调用; 与已有的函数重名时出错
+func RegisterFunc(name string, f Func) error {
+	if name == "" || f == nil {
+		return fmt.Errorf("RegisterFunc: empty name or func")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := funcs[name]; ok {
+		return fmt.Errorf("func %s already exists", name)
+	}
+	funcs[name] = f
+	return nil
+}
+
+func lookupFunc(name string) (Func, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := funcs[name]
+	return f, ok
+}
+
+func unregisterFunc(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(funcs, name)
+}
+
+// RegisterDirective 注册指令name, name以$开头: RegisterDirective("$repeat", repeat);
+// 与内置指令或已有的指令重名时出错
+func RegisterDirective(name string, dir Directive) error {
+	if !strings.HasPrefix(name, "$") || len(name) < 2 || dir == nil {
+		return fmt.Errorf("RegisterDirective: %s should start with $", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("directive %s already exists", name)
+	}
+	if _, ok := directives[name]; ok {
+		return fmt.Errorf("directive %s already exists", name)
+	}
+	directives[name] = dir
+	return nil
+}
+
+func lookupDirective(name string) (Directive, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	dir, ok := directives[name]
+	return dir, ok
+}
+
+// expand 调用自定义指令, 返回每个输出中的替换
+func expand(it string, js *jsnm.Jsnm, rangePaths RangePath) []*subst {
+	vals, err := rangePaths.directive(js.RawData().Raw(), rangePaths.suffixPaths, rangePaths.params)
+	if err != nil {
+		log.Errorf("%s, err:%+v", it, err)
+		return nil
+	}
+	ret := make([]*subst, len(vals))
+	for i, v := range vals {
+		ret[i] = iterMeta(i, len(vals), -1)
+		ret[i].set(it, v, -1)
+	}
+	return ret
+}
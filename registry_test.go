@@ -0,0 +1,84 @@
+package jdecode
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	mask := func(in interface{}, args []interface{}) (interface{}, error) {
+		s := toStr(in)
+		if len(s) <= 4 {
+			return s, nil
+		}
+		return strings.Repeat("*", len(s)-4) + s[len(s)-4:], nil
+	}
+	// $repeat?n=2 重复数组的每个元素n次, 后面的路径取自元素
+	repeat := func(val interface{}, suffix []string, params url.Values) ([]interface{}, error) {
+		arr, ok := val.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%+v is not an array", val)
+		}
+		n, err := strconv.Atoi(params.Get("n"))
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]interface{}, 0, len(arr)*n)
+		for _, it := range arr {
+			if m, ok := it.(map[string]interface{}); ok && len(suffix) > 0 {
+				it = m[suffix[0]]
+			}
+			for i := 0; i < n; i++ {
+				ret = append(ret, it)
+			}
+		}
+		return ret, nil
+	}
+
+	if err := RegisterFunc("mask", mask); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterFunc("mask")
+	if err := RegisterFunc("upper", mask); err == nil {
+		t.Errorf("RegisterFunc upper, want err")
+	}
+	if err := RegisterDirective("$repeat", repeat); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		registryMu.Lock()
+		delete(directives, "$repeat")
+		registryMu.Unlock()
+	}()
+	for _, name := range []string{"$repeat", "$range", "repeat"} {
+		if err := RegisterDirective(name, repeat); err == nil {
+			t.Errorf("RegisterDirective %s, want err", name)
+		}
+	}
+
+	prebs := []byte(`{"card":"6222020012345678","users":[{"id":"u1"},{"id":"u2"}]}`)
+	tcases := []testcase{
+		{
+			raw: `{"card":"@card|mask"}`,
+			des: []string{`{"card":"************5678"}`},
+		},
+		{
+			raw: `{"id":"@users,$repeat?n=2,id","i":"@$index"}`,
+			des: []string{`{"id":"u1","i":0}`, `{"id":"u1","i":1}`, `{"id":"u2","i":2}`, `{"id":"u2","i":3}`},
+		},
+		{
+			raw: `{"id":"@card,$repeat?n=2"}`,
+			des: []string{},
+		},
+	}
+	for _, tc := range tcases {
+		des, _ := Decode(tc.raw, prebs)
+		if !reflect.DeepEqual(des, tc.des) {
+			t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+// maxSteps 脚本默认的最大执行步数, 防止死循环
+const maxSteps = 1000000
+
+func init() {
+	gens["script"] = genScript
+}
+
+// genScript $script('file.star', args...), 调用脚本中的 main(resp, *args), 返回值须可转为json:
+//
+//	def main(resp, n):
+//	    return [it["id"] for it in resp["items"]][:n]
+//
+// 脚本在沙箱中运行, 不能读写文件和网络, 只能使用内置函数和json模块
+func genScript(d *Decoder, ctx *Context, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("script('file.star', args...) needs a file")
+	}
+	sargs := make(starlark.Tuple, 0, len(args))
+	for _, it := range append([]interface{}{d.get(ctx).RawData().Raw()}, args[1:]...) {
+		v, err := toStarlark(it)
+		if err != nil {
+			return nil, err
+		}
+		sargs = append(sargs, v)
+	}
+	return d.callScript(toStr(args[0]), "main", sargs)
+}
+
+// SetMaxExecutionSteps 设置脚本的最大执行步数, 超过时脚本出错; 0为不限制
+func (d *Decoder) SetMaxExecutionSteps(n uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.steps = n
+}
+
+func SetMaxExecutionSteps(n uint64) {
+	std.SetMaxExecutionSteps(n)
+}
+
+// UseScript 使用脚本file中的渲染钩子, file为空时取消:
+//
+//	def pre_render(req, resp):   # req为未渲染的模板, 返回新的模板
+//	    req["trace"] = "@$uuid"
+//	    return req
+//	def post_render(req, resp):  # req为渲染完成的请求, 返回新的请求
+//	    return req
+//
+// 钩子可以只定义一个, 返回None时不修改; 返回的对象按key排序
+func (d *Decoder) UseScript(file string) error {
+	if file != "" {
+		if _, err := d.loadScript(file); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks = file
+	return nil
+}
+
+func UseScript(file string) error {
+	return std.UseScript(file)
+}
+
+// render 调用渲染钩子name, 出错时不修改raw
+func (d *Decoder) render(ctx *Context, name, raw string) string {
+	d.mu.Lock()
+	file := d.hooks
+	d.mu.Unlock()
+	if file == "" {
+		return raw
+	}
+	globals, err := d.loadScript(file)
+	if err != nil {
+		log.Errorf("%s, err:%+v", file, err)
+		return raw
+	}
+	if _, ok := globals[name]; !ok {
+		return raw
+	}
+	req, err := starlarkJSON("decode", starlark.String(raw))
+	if err != nil {
+		log.Errorf("%s %s, err:%+v", file, name, err)
+		return raw
+	}
+	resp, err := toStarlark(d.get(ctx).RawData().Raw())
+	if err != nil {
+		log.Errorf("%s %s, err:%+v", file, name, err)
+		return raw
+	}
+	ret, err := d.call(file, globals, name, starlark.Tuple{req, resp})
+	if err != nil {
+		log.Errorf("%s %s, err:%+v", file, name, err)
+		return raw
+	}
+	if ret == starlark.None {
+		return raw
+	}
+	out, err := starlarkJSON("encode", ret)
+	if err != nil {
+		log.Errorf("%s %s, err:%+v", file, name, err)
+		return raw
+	}
+	return string(out.(starlark.String))
+}
+
+// loadScript 执行脚本文件, 返回其中定义的全局变量; 同一个文件只执行一次
+func (d *Decoder) loadScript(file string) (starlark.StringDict, error) {
+	d.mu.Lock()
+	globals, ok := d.scripts[file]
+	steps := d.steps
+	d.mu.Unlock()
+	if ok {
+		return globals, nil
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	thread := &starlark.Thread{Name: file}
+	thread.SetMaxExecutionSteps(steps)
+	globals, err = starlark.ExecFile(thread, file, src, starlark.StringDict{"json": starjson.Module})
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.scripts[file] = globals
+	d.mu.Unlock()
+	return globals, nil
+}
+
+// callScript 调用脚本file中的函数name, 返回值转为json的值
+func (d *Decoder) callScript(file, name string, args starlark.Tuple) (interface{}, error) {
+	globals, err := d.loadScript(file)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := d.call(file, globals, name, args)
+	if err != nil {
+		return nil, err
+	}
+	return fromStarlark(ret)
+}
+
+func (d *Decoder) call(file string, globals starlark.StringDict, name string, args starlark.Tuple) (starlark.Value, error) {
+	fn, ok := globals[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s not defined", file, name)
+	}
+	d.mu.Lock()
+	steps := d.steps
+	d.mu.Unlock()
+	thread := &starlark.Thread{Name: file}
+	thread.SetMaxExecutionSteps(steps)
+	return starlark.Call(thread, fn, args, nil)
+}
+
+// starlarkJSON 调用json模块的encode, decode
+func starlarkJSON(name string, v starlark.Value) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: "json"}
+	return starlark.Call(thread, starjson.Module.Members[name], starlark.Tuple{v}, nil)
+}
+
+// toStarlark 经json转为starlark的值, 整数转为int
+func toStarlark(v interface{}) (starlark.Value, error) {
+	bs, err := jsonen(v)
+	if err != nil {
+		return nil, err
+	}
+	return starlarkJSON("decode", starlark.String(bs))
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	s, err := starlarkJSON("encode", v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal([]byte(s.(starlark.String)), &ret)
+	return ret, err
+}
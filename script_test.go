@@ -0,0 +1,79 @@
+package jdecode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, src string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	ids := write("ids.star", `
+def main(resp, n, sep):
+    ids = [str(it["id"]) for it in resp["items"] if it["stock"] > 0]
+    return {"ids": sep.join(ids[:n]), "total": len(ids)}
+`)
+	loop := write("loop.star", `
+def main(resp):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return n
+`)
+	hooks := write("hooks.star", `
+def pre_render(req, resp):
+    if resp["debug"]:
+        req["trace"] = "@trace|upper"
+    return req
+
+def post_render(req, resp):
+    req["count"] = req["id"] * 10
+    req.pop("secret")
+    return req
+`)
+	prebs := []byte(`{"debug":true,"trace":"t-1","items":[{"id":1,"stock":2},{"id":2,"stock":0},{"id":3,"stock":5},{"id":4,"stock":1}]}`)
+
+	d := NewDecoder(1)
+	d.SetMaxExecutionSteps(10000)
+	raw := `{"picked":"@$script('` + ids + `', 2, '-')"}`
+	des, _ := d.Decode(raw, prebs)
+	if want := []string{`{"picked":{"ids":"1-3","total":3}}`}; !reflect.DeepEqual(des, want) {
+		t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+	}
+
+	raw = `{"n":"@$script('` + loop + `')"}`
+	des, _ = d.Decode(raw, prebs)
+	if want := []string{raw}; !reflect.DeepEqual(des, want) {
+		t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+	}
+
+	if err := d.UseScript(hooks); err != nil {
+		t.Fatal(err)
+	}
+	raw = `{"id":"@items,$range?limit=2,id","secret":"x"}`
+	des, _ = d.Decode(raw, prebs)
+	want := []string{
+		`{"count":10,"id":1,"trace":"T-1"}`,
+		`{"count":20,"id":2,"trace":"T-1"}`,
+	}
+	if !reflect.DeepEqual(des, want) {
+		t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+	}
+
+	if err := d.UseScript(filepath.Join(dir, "none.star")); err == nil {
+		t.Errorf("UseScript none.star, want err")
+	}
+}
@@ -0,0 +1,489 @@
+package jdecode
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tealeg/xlsx"
+	"github.com/toukii/jsnm"
+)
+
+// Source 数据源, 逐条读取记录, 读完时返回io.EOF; 记录为json, 如csv的一行为一个对象
+type Source interface {
+	Next() (json.RawMessage, error)
+	Close() error
+}
+
+// OpenSource 打开数据文件, 文件格式同DecodeDataFile: @users.csv, @orders.ndjson, @ids.txt;
+// 以.gz, .zst结尾的文件先解压, 格式由去掉压缩后缀的文件名决定: @ids.csv.gz, @ids.jsonl.zst;
+// 含有 * ? [ 时为多个文件, 按文件名排序后依次读取: @shards/part-*.csv;
+// sqlite:开头时为sqlite数据库的查询结果: @sqlite:fixtures.db?query=SELECT id,name FROM users;
+// 除excel外都逐条读取, 不会把整个文件读入内存
+func OpenSource(name string) (Source, error) {
+	name = strings.TrimPrefix(name, "@")
+	if strings.HasPrefix(name, sqlitePrefix) {
+		return sqliteSource(name)
+	}
+	if !isGlob(name) {
+		return openSource(name)
+	}
+	names, err := filepath.Glob(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= 0 {
+		return nil, fmt.Errorf("no file matches %s", name)
+	}
+	sort.Strings(names)
+	return &multiSource{names: names}, nil
+}
+
+// isGlob 文件名中是否含有通配符
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// isCompressed 文件是否压缩
+func isCompressed(name string) bool {
+	return strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".zst")
+}
+
+// openSource 打开单个数据文件
+func openSource(name string) (Source, error) {
+	format := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	if strings.HasSuffix(format, ".xlsx") || strings.Contains(format, ".xlsx#") {
+		if isCompressed(name) {
+			return nil, fmt.Errorf("%s: compressed excel is not supported", name)
+		}
+		return excelSource(name)
+	}
+	r, err := openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(format, ".csv"):
+		return newCSVSource(r)
+	case strings.HasSuffix(format, ".ndjson") || strings.HasSuffix(format, ".jsonl"):
+		return newNDJSONSource(r), nil
+	case strings.HasSuffix(format, ".json"):
+		return newJSONSource(r)
+	}
+	return newLineSource(r), nil
+}
+
+// decompressor 解压的reader, 关闭时同时关闭文件
+type decompressor struct {
+	io.Reader
+	closers []func() error
+}
+
+func (d *decompressor) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openFile 打开文件, 以.gz, .zst结尾时解压
+func openFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %+v", name, err)
+		}
+		return &decompressor{Reader: zr, closers: []func() error{zr.Close, f.Close}}, nil
+	case strings.HasSuffix(name, ".zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %+v", name, err)
+		}
+		return &decompressor{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }, f.Close}}, nil
+	}
+	return f, nil
+}
+
+// multiSource 依次读取多个文件的记录, 读到某个文件时才打开
+type multiSource struct {
+	names []string
+	cur   Source
+}
+
+func (s *multiSource) Next() (json.RawMessage, error) {
+	for {
+		if s.cur == nil {
+			if len(s.names) <= 0 {
+				return nil, io.EOF
+			}
+			src, err := openSource(s.names[0])
+			if err != nil {
+				return nil, err
+			}
+			s.cur, s.names = src, s.names[1:]
+		}
+		rec, err := s.cur.Next()
+		if err != io.EOF {
+			return rec, err
+		}
+		s.cur.Close()
+		s.cur = nil
+	}
+}
+
+func (s *multiSource) Close() error {
+	s.names = nil
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	return err
+}
+
+// collect 读取全部记录, 转为json数组
+func collect(src Source) (string, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for n := 0; ; n++ {
+		rec, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(rec)
+	}
+	buf.WriteByte(']')
+	return buf.String(), nil
+}
+
+// csvSource csv的每行为一个对象, 参见DecodeDataCSVFile
+type csvSource struct {
+	io.Closer
+	reader *csv.Reader
+	cols   []csvColumn
+}
+
+func newCSVSource(r io.ReadCloser) (*csvSource, error) {
+	src := &csvSource{Closer: r, reader: csv.NewReader(r)}
+	header, err := src.reader.Read()
+	if err == io.EOF {
+		return src, nil
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if src.cols, err = csvColumns(header); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+func (s *csvSource) Next() (json.RawMessage, error) {
+	if s.cols == nil {
+		return nil, io.EOF
+	}
+	row, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, col := range s.cols {
+		v, err := csvValue(col, row[i])
+		if err != nil {
+			line, _ := s.reader.FieldPos(i)
+			return nil, fmt.Errorf("line %d, column %s: %+v", line, col.name, err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s:%s", quote(col.name), v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ndjsonSource 每行一个json, 忽略空行
+type ndjsonSource struct {
+	io.Closer
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONSource(r io.ReadCloser) *ndjsonSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &ndjsonSource{Closer: r, scanner: scanner}
+}
+
+func (s *ndjsonSource) Next() (json.RawMessage, error) {
+	for s.scanner.Scan() {
+		s.line++
+		record := bytes.TrimSpace(s.scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, record); err != nil {
+			return nil, fmt.Errorf("line %d: %+v", s.line, err)
+		}
+		return buf.Bytes(), nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// jsonSource json数组的每个元素为一条记录, 其他的值为一条记录
+type jsonSource struct {
+	io.Closer
+	dec   *json.Decoder
+	array bool
+	last  bool // 不是数组时, 已读取唯一的记录
+	done  bool
+}
+
+func newJSONSource(r io.ReadCloser) (*jsonSource, error) {
+	br := bufio.NewReader(r)
+	src := &jsonSource{Closer: r, dec: json.NewDecoder(br)}
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			// 空文件没有记录
+			src.done = true
+			break
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		if b[0] == '[' {
+			src.dec.Token()
+			src.array = true
+			break
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			break
+		}
+		br.ReadByte()
+	}
+	return src, nil
+}
+
+func (s *jsonSource) Next() (json.RawMessage, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	if s.last || (s.array && !s.dec.More()) {
+		return nil, s.end()
+	}
+	var rec json.RawMessage
+	if err := s.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	if !s.array {
+		s.last = true
+	}
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, rec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// end 读完记录, 之后只能有空白: {"a":1}{"a":2}, [1,2] xx 出错
+func (s *jsonSource) end() error {
+	s.done = true
+	if s.array {
+		if _, err := s.dec.Token(); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+	}
+	tok, err := s.dec.Token()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected %v after the last record", tok)
+}
+
+// lineSource 每行为一个字符串, 以"开头且是合法json字符串的行原样使用, 其他的行转义: a"b ==> "a\"b"
+type lineSource struct {
+	io.Closer
+	scanner *bufio.Scanner
+}
+
+func newLineSource(r io.ReadCloser) *lineSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &lineSource{Closer: r, scanner: scanner}
+}
+
+func (s *lineSource) Next() (json.RawMessage, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	line := s.scanner.Text()
+	if strings.HasPrefix(line, `"`) && json.Valid([]byte(line)) {
+		return json.RawMessage(line), nil
+	}
+	return json.RawMessage(quote(line)), nil
+}
+
+// excelSource 选择的区域逐行转为记录; xlsx会解析文件中的所有工作表, 区域有结束行时每个工作表只解析到结束行:
+// users.xlsx#Sheet2!A1:F200 只读前200行, 没有结束行时整个文件读入内存
+func excelSource(name string) (Source, error) {
+	filename, sel := splitSheet(name)
+	sheet, area := splitArea(sel)
+	rng, err := parseRange(area)
+	if err != nil {
+		return nil, err
+	}
+	limit := xlsx.NoRowLimit
+	if rng.toRow >= 0 {
+		limit = rng.toRow + 1
+	}
+	excel, err := xlsx.OpenFileWithRowLimit(filename, limit)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := findSheet(excel, sheet)
+	if err != nil {
+		return nil, err
+	}
+	return newSheetSource(sh, rng, excel.Date1904)
+}
+
+// DecodeSourceByChan 流式展开模板中的@$file,$range: 从src逐条读取记录, 每条记录生成一个请求发送到ivkData,
+// 读完时关闭src并发送dataEnd; 内存占用与src的大小无关. $range支持 offset, every, limit, where 参数,
+// 可以使用@$index, @$first, @$last; 总数未知, 不支持@$count和sample. 记录只替换到@$file,$range中, 不再被解析;
+// 模板中的其他占位符以ctx求值. 模板中没有@$file,$range时出错; DecodeDataFile 和 DecodeContext 不使用流式读取
+func (d *Decoder) DecodeSourceByChan(raw string, ctx *Context, src Source, ivkData chan string, dataEnd chan bool) error {
+	var it string
+	var rangePaths RangePath
+	for _, path := range subDecode(raw, true) {
+		if path == "$count" || strings.HasPrefix(path, "$count|") {
+			return fmt.Errorf("@$count is not supported when streaming")
+		}
+		rp := TrimPath(strings.Split(path, ","))
+		if it == "" && rp.ranged && len(rp.prefixPaths) == 1 && rp.prefixPaths[0] == "$file" {
+			it, rangePaths = path, rp
+		}
+	}
+	if it == "" {
+		return fmt.Errorf("no @$file,$range in %s", raw)
+	}
+	if rangePaths.params.Get("sample") != "" {
+		return fmt.Errorf("%s: sample is not supported when streaming", it)
+	}
+	if _, _, _, _, err := rangeParams(rangePaths.params); err != nil {
+		return fmt.Errorf("%s: %+v", it, err)
+	}
+	go func() {
+		defer func() { dataEnd <- true }()
+		defer src.Close()
+		d.stream(raw, it, ctx, src, rangePaths, ivkData)
+	}()
+	return nil
+}
+
+func DecodeSourceByChan(raw string, ctx *Context, src Source, ivkData chan string, dataEnd chan bool) error {
+	return std.DecodeSourceByChan(raw, ctx, src, ivkData, dataEnd)
+}
+
+// stream 逐条读取记录并展开, 预读一条以确定@$last
+func (d *Decoder) stream(raw, it string, ctx *Context, src Source, rangePaths RangePath, ivkData chan string) {
+	params := rangePaths.params
+	offset, every, _, limit, _ := rangeParams(params)
+	where := params.Get("where")
+	next := func() (*jsnm.Jsnm, bool) {
+		for {
+			rec, err := src.Next()
+			if err != nil {
+				if err != io.EOF {
+					log.Errorf("%s, err:%+v", it, err)
+				}
+				return nil, false
+			}
+			js := jsnm.BytesFmt(rec)
+			if where == "" {
+				return js, true
+			}
+			if expr, ok := isCel(where); ok {
+				if d.evalCel(ctx, expr, js.RawData().Raw()) {
+					return js, true
+				}
+			} else if d.evalCond(ctx.fork(rec), where) {
+				return js, true
+			}
+		}
+	}
+
+	for i := 0; i < offset; i++ {
+		if _, ok := next(); !ok {
+			return
+		}
+	}
+	cur, ok := next()
+	for i := 0; ok && (limit < 0 || i < limit); i++ {
+		var nxt *jsnm.Jsnm
+		hasNext := false
+		if limit < 0 || i+1 < limit {
+			for j := 0; j < every; j++ {
+				if nxt, hasNext = next(); !hasNext {
+					break
+				}
+			}
+		}
+		item := streamMeta(i, !hasNext)
+		item.set(it, cur.ArrGet(rangePaths.suffixPaths...).RawData().Raw(), 1)
+		d.generate(ctx, raw, item, 100, func(out string) {
+			ivkData <- out
+		})
+		cur, ok = nxt, hasNext
+	}
+}
+
+// streamMeta 流式展开的元信息@$index, @$first, @$last; 总数未知, 不支持@$count
+func streamMeta(index int, last bool) *subst {
+	s := &subst{}
+	s.set("$index", index, -1)
+	s.set("$first", index == 0, -1)
+	s.set("$last", last, -1)
+	return s
+}
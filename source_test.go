@@ -0,0 +1,102 @@
+package jdecode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buf := &strings.Builder{}
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(buf, "{\"id\":\"u%d\",\"n\":%d}\n", i, i)
+	}
+	file := filepath.Join(dir, "users.ndjson")
+	if err = ioutil.WriteFile(file, []byte(buf.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ids := filepath.Join(dir, "ids.txt")
+	if err = ioutil.WriteFile(ids, []byte("a\n\"b\"\nc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inject := filepath.Join(dir, "inject.ndjson")
+	if err = ioutil.WriteFile(inject, []byte("\"@token\"\n{\"k\":\"@token|upper\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext([]byte(`{"token":"tk"}`))
+	tcases := []struct {
+		file, raw string
+		des       []string
+	}{
+		{
+			file: file,
+			raw:  `{"id":"@$file,$range?offset=1&every=2&limit=3&where=n > 2,id","i":"@$index","last":"@$last","token":"@token"}`,
+			des: []string{
+				`{"id":"u4","i":0,"last":false,"token":"tk"}`,
+				`{"id":"u6","i":1,"last":false,"token":"tk"}`,
+				`{"id":"u8","i":2,"last":true,"token":"tk"}`,
+			},
+		},
+		{
+			file: file,
+			raw:  `{"user":"@$file,$range?where=n >= 9998","first":"@$first","last":"@$last"}`,
+			des: []string{
+				`{"user":{"id":"u9998","n":9998},"first":true,"last":false}`,
+				`{"user":{"id":"u9999","n":9999},"first":false,"last":true}`,
+			},
+		},
+		{
+			file: ids,
+			raw:  `{"id":"@$file,$range"}`,
+			des:  []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`},
+		},
+		{
+			// 记录中的占位符不再被解析
+			file: inject,
+			raw:  `{"id":"@$file,$range","token":"@token"}`,
+			des:  []string{`{"id":"@token","token":"tk"}`, `{"id":{"k":"@token|upper"},"token":"tk"}`},
+		},
+	}
+	for _, tc := range tcases {
+		src, err := OpenSource("@" + tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ivkData, dataEnd := make(chan string), make(chan bool)
+		if err = DecodeSourceByChan(tc.raw, ctx, src, ivkData, dataEnd); err != nil {
+			t.Fatal(err)
+		}
+		des := []string{}
+	loop:
+		for {
+			select {
+			case it := <-ivkData:
+				des = append(des, it)
+			case <-dataEnd:
+				break loop
+			}
+		}
+		if !reflect.DeepEqual(des, tc.des) {
+			t.Errorf("decode: %s, want: %s, got: %s", tc.raw, tc.des, des)
+		}
+	}
+
+	src, _ := OpenSource("@" + file)
+	defer src.Close()
+	for _, raw := range []string{`{"id":"@users,$range"}`, `{"id":"@$file,$range?sample=2"}`, `{"id":"@$file,$range","n":"@$count"}`, `{"id":"@$file,$range?limit=ten"}`} {
+		if err := DecodeSourceByChan(raw, ctx, src, nil, nil); err == nil {
+			t.Errorf("decode: %s, want err", raw)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// store 持久化的变量, 模板中以@store:name引用
+const store = "store"
+
+var (
+	lockSeq int64
+	// lockStale 锁文件超过这个时间未释放时, 认为持有锁的进程已退出
+	lockStale = 30 * time.Second
+	// lockTimeout 等待锁文件的最长时间, 长于lockStale, 等待中总能删除过期的锁
+	lockTimeout = 2 * lockStale
+)
+
+// Store 保存在json文件中的变量, 在多次运行之间保留, 如创建的租户id, refresh token;
+// 变量可以设置过期时间; 同一台机器上的多个进程通过锁文件互斥读写
+type Store struct {
+	path  string
+	clock func() time.Time // 判断过期的时钟
+}
+
+type storeItem struct {
+	Value   interface{} `json:"value"`
+	Expires int64       `json:"expires,omitempty"` // unix毫秒, 0为不过期
+}
+
+// OpenStore 打开path对应的文件, 不存在时在第一次写入时创建
+func OpenStore(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{path: path, clock: time.Now}, nil
+}
+
+// Get 返回未过期的变量key
+func (s *Store) Get(key string) (interface{}, bool, error) {
+	items, err := s.All()
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := items[key]
+	return v, ok, nil
+}
+
+// All 返回所有未过期的变量
+func (s *Store) All() (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	err := s.locked(func(items map[string]storeItem) bool {
+		for k, it := range items {
+			ret[k] = it.Value
+		}
+		return false
+	})
+	return ret, err
+}
+
+// Set 保存变量key, ttl<=0时不过期
+func (s *Store) Set(key string, v interface{}, ttl time.Duration) error {
+	item := storeItem{Value: v}
+	if ttl > 0 {
+		item.Expires = s.clock().Add(ttl).UnixNano() / int64(time.Millisecond)
+	}
+	return s.locked(func(items map[string]storeItem) bool {
+		items[key] = item
+		return true
+	})
+}
+
+// Delete 删除变量key
+func (s *Store) Delete(key string) error {
+	return s.locked(func(items map[string]storeItem) bool {
+		delete(items, key)
+		return true
+	})
+}
+
+// locked 持有锁文件时读取未过期的变量, fn返回true时写回文件
+func (s *Store) locked(fn func(items map[string]storeItem) bool) error {
+	token, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer s.unlock(token)
+
+	items := make(map[string]storeItem)
+	bs, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(bs) > 0 {
+		if err = json.Unmarshal(bs, &items); err != nil {
+			return fmt.Errorf("store %s: %+v", s.path, err)
+		}
+	}
+	now := s.clock().UnixNano() / int64(time.Millisecond)
+	expired := false
+	for k, it := range items {
+		if it.Expires > 0 && it.Expires <= now {
+			delete(items, k)
+			expired = true
+		}
+	}
+	if !fn(items) && !expired {
+		return nil
+	}
+
+	if bs, err = json.MarshalIndent(items, "", "  "); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// lock 创建锁文件, 已存在时等待; 返回写入锁文件的token, 用于确认锁的持有者
+func (s *Store) lock() (string, error) {
+	lockfile := s.path + ".lock"
+	token := lockToken()
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(lockfile)
+				return "", err
+			}
+			return token, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		if fi, err := os.Stat(lockfile); err == nil && time.Since(fi.ModTime()) > lockStale {
+			s.removeStale(lockfile)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("store %s: lock timeout", s.path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// removeStale 删除过期的锁文件; 先改名再核对内容, 不会删除其他进程刚创建的锁
+func (s *Store) removeStale(lockfile string) {
+	bs, err := ioutil.ReadFile(lockfile)
+	if err != nil {
+		return
+	}
+	tmp := lockfile + "." + lockToken()
+	if err = os.Rename(lockfile, tmp); err != nil {
+		return
+	}
+	defer os.Remove(tmp)
+	if got, err := ioutil.ReadFile(tmp); err != nil || string(got) != string(bs) {
+		// 锁已被其他进程换过, 放回原处
+		os.Link(tmp, lockfile)
+		return
+	}
+	log.Warnf("store %s: remove stale lock %s", s.path, bs)
+}
+
+// lockToken 锁文件的内容, 进程内外唯一
+func lockToken() string {
+	return fmt.Sprintf("%d-%d-%d", os.Getpid(), time.Now().UnixNano(), atomic.AddInt64(&lockSeq, 1))
+}
+
+// unlock 锁文件仍为token时删除
+func (s *Store) unlock(token string) {
+	lockfile := s.path + ".lock"
+	if bs, err := ioutil.ReadFile(lockfile); err == nil && string(bs) == token {
+		os.Remove(lockfile)
+	}
+}
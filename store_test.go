@@ -0,0 +1,114 @@
+package jdecode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jdecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Store ttl", func(t *testing.T) {
+		s, err := OpenStore(filepath.Join(dir, "ttl", "store.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.clock = func() time.Time { return now }
+		s.Set("tenant", "t1", 0)
+		s.Set("token", "tk", time.Hour)
+		if v, ok, err := s.Get("token"); err != nil || !ok || v != "tk" {
+			t.Errorf("Get token ==> tk, but: %+v, ok: %t, err: %+v", v, ok, err)
+		}
+		now = now.Add(2 * time.Hour)
+		items, err := s.All()
+		if want := map[string]interface{}{"tenant": "t1"}; err != nil || !reflect.DeepEqual(items, want) {
+			t.Errorf("All ==> %+v, but: %+v, err: %+v", want, items, err)
+		}
+	})
+
+	t.Run("Store lock", func(t *testing.T) {
+		path := filepath.Join(dir, "lock.json")
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				s, _ := OpenStore(path)
+				if err := s.Set(fmt.Sprint("k", i), float64(i), 0); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		s, _ := OpenStore(path)
+		if items, err := s.All(); err != nil || len(items) != 10 {
+			t.Errorf("All ==> 10 items, but: %+v, err: %+v", items, err)
+		}
+	})
+
+	t.Run("Store stale lock", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.json")
+		lockfile := path + ".lock"
+		if err := ioutil.WriteFile(lockfile, []byte("1-1-1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * lockStale)
+		os.Chtimes(lockfile, old, old)
+		s, _ := OpenStore(path)
+		if err := s.Set("k", "v", 0); err != nil {
+			t.Errorf("Set with stale lock, err: %+v", err)
+		}
+		if _, err := os.Stat(lockfile); !os.IsNotExist(err) {
+			t.Errorf("lock file left, err: %+v", err)
+		}
+
+		// 锁已被其他进程持有时, unlock不删除
+		token, err := s.lock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(lockfile, []byte("other"), 0644)
+		s.unlock(token)
+		if bs, err := ioutil.ReadFile(lockfile); err != nil || string(bs) != "other" {
+			t.Errorf("unlock removed other's lock: %s, err: %+v", bs, err)
+		}
+		os.Remove(lockfile)
+	})
+
+	t.Run("Store capture", func(t *testing.T) {
+		path := filepath.Join(dir, "capture.json")
+		s, _ := OpenStore(path)
+		ctx := NewContext(nil)
+		ctx.UseStore(s)
+		err := Capture(ctx, `persist tenant := @data,tenant,id ttl 24h`, []byte(`{"data":{"tenant":{"id":"t-001"}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 下一次运行
+		s, _ = OpenStore(path)
+		ctx = NewContext(nil)
+		ctx.UseStore(s)
+		raw := `{"tenant":"@store:tenant"}`
+		des, _ := DecodeContext(raw, ctx)
+		if want := []string{`{"tenant":"t-001"}`}; !reflect.DeepEqual(des, want) {
+			t.Errorf("decode: %s, want: %s, got: %s", raw, want, des)
+		}
+
+		if err := Capture(NewContext(nil), `persist tenant := @id`, []byte(`{"id":"t"}`)); err == nil {
+			t.Errorf("persist without store, want err")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package jdecode
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// subst 模板中占位符的替换: 一次扫描模板完成所有的替换, 替换进的值不会再被当作占位符;
+// 同一位置有多个占位符匹配时, 较长的优先: "@vals,$range" 优先于 "@vals
+type subst struct {
+	olds, news []string
+	counts     []int // 替换的次数, -1为不限
+}
+
+// add 替换old为new, 至多n次
+func (s *subst) add(old, new string, n int) {
+	s.olds = append(s.olds, old)
+	s.news = append(s.news, new)
+	s.counts = append(s.counts, n)
+}
+
+// set 将占位符 "@it" 替换为v的json; 占位符后有其他字符时按字符串拼接, 不是字符串的值以json拼接:
+// "@$index-k" ==> "0-k", "@$value-x" ==> "{\"max\":4}-x"
+func (s *subst) set(it string, v interface{}, n int) {
+	bs, err := jsonen(v)
+	if err != nil {
+		log.Errorf("%s: %+v, err:%+v", it, v, err)
+		return
+	}
+	placeholder := quote("@" + it)
+	s.add(placeholder, string(bs), n)
+	str, ok := v.(string)
+	if !ok {
+		str = string(bs)
+	}
+	s.add(placeholder[:len(placeholder)-1], inquote(str), n)
+}
+
+// inquote 字符串的json, 不含结尾的引号, 用于拼接: a"b ==> "a\"b
+func inquote(s string) string {
+	q := quote(s)
+	return q[:len(q)-1]
+}
+
+// merge 返回包含s和o的替换
+func (s *subst) merge(o *subst) *subst {
+	ret := &subst{}
+	for _, it := range []*subst{s, o} {
+		if it == nil {
+			continue
+		}
+		ret.olds = append(ret.olds, it.olds...)
+		ret.news = append(ret.news, it.news...)
+		ret.counts = append(ret.counts, it.counts...)
+	}
+	return ret
+}
+
+// apply 替换raw中的占位符
+func (s *subst) apply(raw string) string {
+	if s == nil || len(s.olds) <= 0 {
+		return raw
+	}
+	order := make([]int, len(s.olds))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(s.olds[order[i]]) > len(s.olds[order[j]])
+	})
+	counts := make([]int, len(s.counts))
+	copy(counts, s.counts)
+
+	buf := &bytes.Buffer{}
+	for {
+		idx := strings.Index(raw, `"@`)
+		if idx < 0 {
+			break
+		}
+		buf.WriteString(raw[:idx])
+		raw = raw[idx:]
+		matched := false
+		for _, i := range order {
+			if counts[i] != 0 && strings.HasPrefix(raw, s.olds[i]) {
+				buf.WriteString(s.news[i])
+				raw = raw[len(s.olds[i]):]
+				counts[i]--
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			buf.WriteByte('"')
+			raw = raw[1:]
+		}
+	}
+	buf.WriteString(raw)
+	return buf.String()
+}
+
+// plain 将占位符 "@it" 替换为路径的值, 格式参见value
+func (s *subst) plain(it string, val interface{}) {
+	vv, typ := value(val)
+	if vv == "" {
+		return
+	}
+	placeholder := quote("@" + it)
+	if typ != "string" {
+		s.add(placeholder, vv, -1)
+	}
+	s.add(placeholder[:len(placeholder)-1], inquote(vv), -1)
+}
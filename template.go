@@ -0,0 +1,137 @@
+package jdecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Template 检查过的模板, 绑定编译时的Decoder
+type Template struct {
+	raw string
+	d   *Decoder
+}
+
+// Compile 检查模板: json格式, 函数管道中的函数, @{}表达式, $if和$range?where的条件;
+// cel:开头的条件做类型检查, 编译结果缓存, 求值时不再编译; 模板以d求值
+func (d *Decoder) Compile(raw string) (*Template, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("template: %+v", err)
+	}
+	if err := compileNode(v); err != nil {
+		return nil, err
+	}
+	return &Template{raw: raw, d: d}, nil
+}
+
+func Compile(raw string) (*Template, error) {
+	return std.Compile(raw)
+}
+
+// MustCompile 同Compile, 出错时panic
+func (d *Decoder) MustCompile(raw string) *Template {
+	t, err := d.Compile(raw)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func MustCompile(raw string) *Template {
+	return std.MustCompile(raw)
+}
+
+// Raw 返回模板
+func (t *Template) Raw() string {
+	return t.raw
+}
+
+// Decode 以编译模板的Decoder求值
+func (t *Template) Decode(ctx *Context) ([]string, string) {
+	return t.d.DecodeContext(t.raw, ctx)
+}
+
+func compileNode(v interface{}) error {
+	switch vv := v.(type) {
+	case string:
+		it, ok := getLetterStr([]byte(vv))
+		if !ok {
+			return nil
+		}
+		return compilePlaceholder(it)
+	case []interface{}:
+		for _, it := range vv {
+			if err := compileNode(it); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if cond, ok := vv[ifKey].(string); ok {
+			if err := compileCond(cond); err != nil {
+				return fmt.Errorf("%s %s: %+v", ifKey, cond, err)
+			}
+		}
+		for k, it := range vv {
+			if k == ifKey {
+				continue
+			}
+			if err := compileNode(it); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compilePlaceholder 检查占位符中的表达式, 函数和where条件
+func compilePlaceholder(it string) error {
+	if strings.HasPrefix(it, "{") {
+		if _, err := parseExpr(splitExpr(it[1 : len(it)-1])[0]); err != nil {
+			return fmt.Errorf("@%s: %+v", it, err)
+		}
+	}
+	if directiveQuery(it) {
+		for _, seg := range strings.Split(it, ",") {
+			if _, params := splitDirective(seg); params.Get("where") != "" {
+				if err := compileCond(params.Get("where")); err != nil {
+					return fmt.Errorf("@%s: %+v", it, err)
+				}
+			}
+		}
+		return nil
+	}
+	p, ok := parsePipeline(it)
+	if !ok {
+		return nil
+	}
+	for _, c := range p.calls {
+		if _, ok := lookupFunc(c.name); !ok {
+			return fmt.Errorf("@%s: func %s not found", it, c.name)
+		}
+	}
+	return nil
+}
+
+// compileCond 检查条件, 参见evalCond
+func compileCond(cond string) error {
+	if expr, ok := isCel(cond); ok {
+		_, err := compileCel(expr)
+		return err
+	}
+	for _, or := range splitOp(cond, "||") {
+		for _, and := range splitOp(or, "&&") {
+			term := strings.TrimLeft(strings.TrimSpace(and), "! ")
+			if !strings.HasPrefix(term, "@") {
+				if _, err := parseExpr(term); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := compilePlaceholder(term[1:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}